@@ -0,0 +1,578 @@
+package awscfg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/phrase/aws-mfa/yubiauth"
+)
+
+func NewFromPath(path string) (*aws.Config, error) {
+	return NewFromPathWithOptions(path, nil)
+}
+
+// NewFromPathWithOptions is like NewFromPath but the configuration read from
+// path is overridden by opts.
+func NewFromPathWithOptions(path string, opts *Options) (*aws.Config, error) {
+	cfg, creds, err := loadCredentials(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return awsConfig(cfg, creds), nil
+}
+
+// loadCredentials reads the configuration at path and returns the
+// credentials of the last role of its role chain or its base credentials.
+func loadCredentials(path string, opts *Options) (*config, *sts.Credentials, error) {
+	cfg, _, err := resolveConfig(path, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.check(path); err != nil {
+		return nil, nil, err
+	}
+
+	var creds *sts.Credentials
+	if chain := cfg.roleChain(); len(chain) > 0 {
+		creds, err = assumeRoleChain(cfg, chain)
+	} else {
+		creds, err = baseCredentials(cfg)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, creds, nil
+}
+
+// awsConfig returns the config for using the temporary credentials creds.
+// Their expiration is available through Credentials.ExpiresAt.
+func awsConfig(cfg *config, creds *sts.Credentials) *aws.Config {
+	config := aws.NewConfig().WithCredentials(credentials.NewCredentials(&sessionProvider{creds: creds}))
+	if cfg.AWSDefaultRegion != "" {
+		config = config.WithRegion(cfg.AWSDefaultRegion)
+	}
+	return config
+}
+
+var doDebug = os.Getenv("DEBUG") == "true"
+
+func debugStream() io.Writer {
+	if doDebug {
+		return os.Stderr
+	}
+	return ioutil.Discard
+}
+
+var dbg = log.New(debugStream(), "[DEBUG] ", log.Lshortfile)
+
+// cacheDir is where credentials are cached.
+var cacheDir = "/tmp/aws"
+
+// Types of configurations, set as type.
+const (
+	typeIAMUser     = "iam_user"
+	typeSSO         = "sso"
+	typeWebIdentity = "web_identity"
+)
+
+// baseCredentials returns the credentials roles are assumed with, depending
+// on the type of the configuration: MFA session credentials of an IAM user
+// (the default), the role credentials of an IAM Identity Center login or of
+// a role assumed with a web identity token.
+func baseCredentials(cfg *config) (*sts.Credentials, error) {
+	switch cfg.Type {
+	case "", typeIAMUser:
+		return getSTSCredentials(cfg)
+	case typeSSO:
+		return getSSOCredentials(cfg)
+	case typeWebIdentity:
+		return getWebIdentityCredentials(cfg)
+	}
+	return nil, fmt.Errorf("unknown type %q, use %s, %s or %s", cfg.Type, typeIAMUser, typeSSO, typeWebIdentity)
+}
+
+func getSTSCredentials(cfg *config) (creds *sts.Credentials, err error) {
+	name, err := cfg.cacheName()
+	if err != nil {
+		return nil, err
+	}
+	cachePath := filepath.Join(cacheDir, name+".json")
+	if creds := readCachedCredentials(cfg, cachePath); creds != nil {
+		return creds, nil
+	}
+	if err := cfg.resolveAccessKey(); err != nil {
+		return nil, err
+	}
+	dur := 6 * time.Hour
+	if cfg.AWSDuration != "" {
+		dur, err = parseDuration(cfg.AWSDuration)
+		if err != nil {
+			return nil, fmt.Errorf("aws_duration: %s", err)
+		}
+	}
+	if dur, err = sessionTokenLimits.check("aws_duration", dur, cfg.AWSAutoClamp); err != nil {
+		return nil, err
+	}
+
+	d64 := int64(dur.Seconds())
+
+	stsClient := sts.New(session.New(stsConfig(cfg, staticCredentials(cfg))))
+	creds, err = withMFA(cfg, "sts:GetSessionToken", cachePath, stsClient, func(serial, token *string) (*sts.Credentials, error) {
+		res, err := stsClient.GetSessionToken(&sts.GetSessionTokenInput{SerialNumber: serial, DurationSeconds: &d64, TokenCode: token})
+		if err != nil {
+			return nil, err
+		}
+		return res.Credentials, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := storeCredentials(cachePath, creds); err != nil {
+		log.Printf("error storing credentials: %s", err)
+		// ignore for now
+	}
+	return creds, nil
+}
+
+// withMFA calls f with the serial of the MFA device of the IAM user and a
+// code read from the yubikey or the user. Rejected codes are asked for again
+// up to aws_mfa_attempts times. stsClient is the client used by f to call op.
+func withMFA(cfg *config, op, cachePath string, stsClient *sts.STS, f func(serial, token *string) (*sts.Credentials, error)) (*sts.Credentials, error) {
+	skew := &clockSkew{}
+	stsClient.Handlers.Complete.PushBack(skew.handler)
+	i := iam.New(session.New(iamConfig(cfg, staticCredentials(cfg))))
+	res, err := i.ListMFADevices(nil)
+	if err != nil {
+		return nil, explainError(cfg, "iam:ListMFADevices", err)
+	}
+	if len(res.MFADevices) != 1 {
+		return nil, fmt.Errorf("expected 1 mfa device, was %d", len(res.MFADevices))
+	}
+	d := res.MFADevices[0]
+
+	attempts := defaultMFAAttempts
+	if cfg.AWSMFAAttempts > 0 {
+		attempts = cfg.AWSMFAAttempts
+	}
+	usedPath := usedCodePath(cachePath, *d.SerialNumber)
+	last := readUsedCode(usedPath)
+	var token string
+	var generated bool
+	var creds *sts.Credentials
+	for i := 1; ; i++ {
+		token, generated, err = readToken(cfg, last)
+		if err != nil {
+			return nil, err
+		}
+		creds, err = f(d.SerialNumber, &token)
+		if err == nil {
+			break
+		} else if !isMFAError(err) {
+			return nil, explainError(cfg, op, err)
+		}
+		reason := mfaErrorReason(token, generated, last, time.Now(), skew.skew)
+		if i >= attempts {
+			return nil, fmt.Errorf("mfa code not accepted after %d attempts: %s", i, reason)
+		}
+		fmt.Fprintf(os.Stderr, "mfa code not accepted: %s\n", reason)
+		// make sure the rejected code is not read from the yubikey again
+		last = &usedCode{Code: token, Time: time.Now()}
+	}
+	if err := storeUsedCode(usedPath, token, time.Now()); err != nil {
+		dbg.Printf("error storing used code: %s", err)
+	}
+	return creds, nil
+}
+
+func staticCredentials(cfg *config) *credentials.Credentials {
+	return credentials.NewStaticCredentials(cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey, "")
+}
+
+var insertMsg = "insert your yubikey please"
+
+// readToken reads the MFA code from the yubikey or asks for it. generated is
+// true when the code was read from the yubikey.
+func readToken(cfg *config, last *usedCode) (code string, generated bool, err error) {
+	ctx, cf := context.WithCancel(context.Background())
+	defer cf()
+	p := newPrompter(cfg)
+	if k := cfg.AWSYubikey; k != "" {
+		key, ok, err := readFreshKeyFromYubi(ctx, k, yubiOptions(ctx, cfg, p), p, last)
+		if ok {
+			return key, true, nil
+		} else if err != nil {
+			log.Printf("error loading key from yubioath: %s", err)
+		}
+	}
+	code, err = readMFAToken(ctx, p, cfg.AWSAccountName, func(code string) error {
+		return last.check(code, time.Now())
+	})
+	return code, false, err
+}
+
+// readFreshKeyFromYubi waits for the next time step when the code read from
+// the yubikey is about to expire or was already used.
+func readFreshKeyFromYubi(ctx context.Context, key string, opts *yubiauth.Options, p prompter, last *usedCode) (string, bool, error) {
+	code := ""
+	for {
+		wait := codeWait(last, code, time.Now())
+		if wait == 0 && code != "" {
+			return code, true, nil
+		} else if wait > 0 {
+			fmt.Fprintf(os.Stderr, "waiting %s for the next mfa code\n", wait.Round(time.Second))
+			time.Sleep(wait)
+		}
+		v, ok, err := readKeyFromYubi(ctx, key, opts, p)
+		if !ok {
+			return v, ok, err
+		}
+		code = v
+	}
+}
+
+// yubiOptions makes yubiauth ask for the password of a locked OATH
+// application (once) and tell the user when to touch the yubikey.
+func yubiOptions(ctx context.Context, cfg *config, p prompter) *yubiauth.Options {
+	var password string
+	return &yubiauth.Options{
+		Password: func() (string, error) {
+			if password != "" {
+				return password, nil
+			}
+			var err error
+			msg := "Password of the OATH application of your yubikey"
+			if cfg.AWSYubikeyPasswordCommand != "" {
+				password, err = runSecretCommand(ctx, cfg.AWSYubikeyPasswordCommand)
+			} else if hasCommand("pinentry") {
+				password, _, err = readKeyFromPinentry(ctx, msg)
+			} else {
+				password, err = p.prompt(ctx, msg, true)
+			}
+			return password, err
+		},
+		Touch: func(name string) {
+			p.notify(ctx, "touch your yubikey to generate the code for "+name)
+		},
+		Serial:  cfg.AWSYubikeySerial,
+		Account: cfg.AWSYubikey,
+		MaxWait: cfg.yubikeyWait(),
+	}
+}
+
+// runSecretCommand runs cmd with sh and returns its trimmed output, e.g. to
+// read a secret from a password manager.
+func runSecretCommand(ctx context.Context, cmd string) (string, error) {
+	c := exec.CommandContext(ctx, "sh", "-c", cmd)
+	stderr := &bytes.Buffer{}
+	c.Stderr = stderr
+	b, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("running %q: %s: %s", cmd, err, stderr)
+	}
+	out := strings.TrimSpace(string(b))
+	if out == "" {
+		return "", fmt.Errorf("running %q: no output", cmd)
+	}
+	return out, nil
+}
+
+func readKeyFromPinentry(ctx context.Context, desc string) (string, bool, error) {
+	c := exec.CommandContext(ctx, "pinentry")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	c.Stdin = strings.NewReader("SETDESC " + desc + "\nGETPIN\n")
+	c.Stdout = stdout
+	c.Stderr = stderr
+	err := c.Run()
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %s", err, stderr)
+	}
+	for _, l := range strings.Split(stdout.String(), "\n") {
+		if strings.HasPrefix(l, "D ") {
+			return strings.TrimSpace(strings.TrimPrefix(l, "D ")), true, nil
+		}
+	}
+	return "", false, fmt.Errorf("unable to extract pin from %q", stdout.String())
+}
+
+func readKeyFromYubi(ctx context.Context, key string, opts *yubiauth.Options, p prompter) (string, bool, error) {
+	keys, err := loadKeysFromYubi(ctx, opts, p)
+	if err != nil {
+		return "", false, err
+	}
+	name, err := keys.Match(key)
+	if err != nil {
+		return "", false, err
+	}
+	if keys.RequiresTouch(name) {
+		v, err := yubiauth.ReadCode(name, opts)
+		return v, err == nil, err
+	}
+	return keys[name], true, nil
+}
+
+func loadKeysFromYubi(ctx context.Context, opts *yubiauth.Options, p prompter) (yubiauth.Keys, error) {
+	keys, found, err := yubiauth.ReadYubioath(opts)
+	if err != nil {
+		return nil, err
+	} else if found {
+		return keys, nil
+	}
+	nctx, cf := context.WithCancel(ctx)
+	p.notify(nctx, insertMsg)
+	keys, err = yubiauth.WaitForKeys(ctx, opts)
+	cf()
+	if err == context.DeadlineExceeded {
+		return nil, fmt.Errorf("no yubikey connected within %s", opts.MaxWait)
+	} else if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "loaded mfa tokens\n")
+	return keys, nil
+}
+
+type mfaReader func(context.Context, chan string) error
+
+func readMFAToken(ctx context.Context, p prompter, name string, check func(string) error) (string, error) {
+	msg := "AWS MFA token"
+	if name != "" {
+		msg += fmt.Sprintf(" for account %s", name)
+	}
+	msg += " please"
+	prompt := msg
+	for {
+		i, err := p.prompt(ctx, prompt, false)
+		if err != nil {
+			return "", err
+		}
+		prompt = msg
+		if !validCode(i) {
+			continue
+		} else if err := check(i); err != nil {
+			prompt = err.Error() + ". " + msg
+			continue
+		}
+		return i, nil
+	}
+}
+
+// readCachedCredentials returns the credentials cached at path if they are
+// valid for at least another minute and the file is private.
+func readCachedCredentials(cfg *config, path string) *sts.Credentials {
+	dbg.Printf("reading credentials from %s", path)
+	if !privateCache(cfg, path) {
+		return nil
+	}
+	creds, err := readCredentialsFromFile(path)
+	if err == nil {
+		if creds.Expiration.After(time.Now().Add(1 * time.Minute)) {
+			dbg.Printf("credentials present and not out of date: valid for %s", creds.Expiration.Sub(time.Now()))
+			return creds
+		}
+		dbg.Print("credentials present but out of date")
+		os.RemoveAll(path)
+	} else if os.IsNotExist(err) {
+		dbg.Print("credentials not found")
+	} else {
+		dbg.Printf("unknown error: %s", err)
+	}
+	return nil
+}
+
+// clientConfig returns the config shared by the STS and IAM clients using
+// creds.
+func clientConfig(cfg *config, creds *credentials.Credentials) *aws.Config {
+	awsCfg := aws.NewConfig().WithCredentials(creds)
+	if cfg.AWSDefaultRegion != "" {
+		awsCfg = awsCfg.WithRegion(cfg.AWSDefaultRegion)
+	}
+	if doDebug {
+		awsCfg.HTTPClient = &http.Client{Transport: &transport{}}
+	}
+	return withRetries(cfg, awsCfg)
+}
+
+// storeCredentials writes i to path, readable only by the user.
+func storeCredentials(path string, i interface{}) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(i); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// files cached by older versions were readable by everyone
+	return os.Chmod(path, 0600)
+}
+
+func readCredentialsFromFile(path string) (creds *sts.Credentials, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return creds, json.NewDecoder(f).Decode(&creds)
+}
+
+// readConfigFromFile reads a JSON, YAML or TOML config.
+func readConfigFromFile(path string) (*config, error) {
+	b, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &config{}
+	return cfg, decodeConfig(path, b, cfg)
+}
+
+// readConfigFile reads the config file at path, decrypting it if it is
+// encrypted.
+func readConfigFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil || !isEncrypted(b) {
+		return b, err
+	}
+	b, _, err = decryptConfig(context.Background(), path, b, newPrompter(&config{}))
+	return b, err
+}
+
+func readMFACode(accountName string) string {
+	msg := "please provide your AWS MFA access token"
+	if accountName != "" {
+		msg += " for account " + accountName
+	}
+	msg += ": "
+	for {
+		fmt.Fprint(os.Stderr, msg)
+		var code string
+		_, err := fmt.Scanf("%s", &code)
+		if err == nil && validCode(code) {
+			return code
+		}
+	}
+}
+
+func validCode(code string) bool {
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(code) == 6
+}
+
+type config struct {
+	Type string `json:"type,omitempty"`
+
+	AWSAccessKeyID     string `json:"aws_access_key_id"`
+	AWSSecretAccessKey string `json:"aws_secret_access_key"`
+	// commands printing the access key, e.g. of a password manager
+	AWSAccessKeyIDCommand     string `json:"aws_access_key_id_command,omitempty"`
+	AWSSecretAccessKeyCommand string `json:"aws_secret_access_key_command,omitempty"`
+	AWSDefaultRegion          string `json:"aws_default_region"`
+	AWSKeyName                string `json:"aws_key_name"`
+	AWSAccountName            string `json:"aws_account_name,omitempty"`
+	AWSDuration               string `json:"aws_duration,omitempty"`
+	AWSYubikey                string `json:"aws_yubikey,omitempty"`
+	AWSMFAAttempts            int    `json:"aws_mfa_attempts,omitempty"`
+
+	AWSYubikeySerial          string `json:"aws_yubikey_serial,omitempty"`
+	AWSYubikeyWait            string `json:"aws_yubikey_wait,omitempty"`
+	AWSYubikeyPasswordCommand string `json:"aws_yubikey_password_command,omitempty"`
+	AWSPrompt                 string `json:"aws_prompt,omitempty"`
+	AWSAutoClamp              bool   `json:"aws_auto_clamp,omitempty"`
+	AWSSTSEndpoint            string `json:"aws_sts_endpoint,omitempty"`
+	AWSIAMEndpoint            string `json:"aws_iam_endpoint,omitempty"`
+	AWSSTSRegionalEndpoints   bool   `json:"aws_sts_regional_endpoints,omitempty"`
+	AWSMaxRetries             int    `json:"aws_max_retries,omitempty"`
+	AWSLenientPermissions     bool   `json:"aws_lenient_permissions,omitempty"`
+
+	SSOStartURL  string `json:"sso_start_url,omitempty"`
+	SSORegion    string `json:"sso_region,omitempty"`
+	SSOAccountID string `json:"sso_account_id,omitempty"`
+	SSORoleName  string `json:"sso_role_name,omitempty"`
+
+	WebIdentityRoleARN      string `json:"web_identity_role_arn,omitempty"`
+	WebIdentityTokenFile    string `json:"web_identity_token_file,omitempty"`
+	WebIdentityTokenCommand string `json:"web_identity_token_command,omitempty"`
+
+	AWSFederationEndpoint string `json:"aws_federation_endpoint,omitempty"`
+
+	RoleARN           string            `json:"role_arn,omitempty"`
+	RoleSessionName   string            `json:"role_session_name,omitempty"`
+	RoleDuration      string            `json:"role_duration,omitempty"`
+	Tags              map[string]string `json:"tags,omitempty"`
+	TransitiveTagKeys []string          `json:"transitive_tag_keys,omitempty"`
+	SourceIdentity    string            `json:"source_identity,omitempty"`
+	Policy            string            `json:"policy,omitempty"`
+	PolicyARNs        []string          `json:"policy_arns,omitempty"`
+	RoleChain         []roleHop         `json:"role_chain,omitempty"`
+}
+
+// yubikeyWait returns the maximum time to wait for a yubikey to be
+// connected before asking for the code. Without a limit (the default) aws-mfa
+// waits until a yubikey is connected.
+func (cfg *config) yubikeyWait() time.Duration {
+	if cfg.AWSYubikeyWait == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(cfg.AWSYubikeyWait)
+	if err != nil {
+		log.Printf("invalid aws_yubikey_wait %q: %s", cfg.AWSYubikeyWait, err)
+		return 0
+	}
+	return d
+}
+
+type transport struct {
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	log.Printf("method=%s url=%s", r.Method, r.URL)
+	rsp, err := http.DefaultClient.Do(r)
+	return rsp, err
+}
+
+// sessionProvider provides temporary credentials.
+type sessionProvider struct {
+	creds *sts.Credentials
+}
+
+func (p *sessionProvider) Retrieve() (credentials.Value, error) {
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(p.creds.AccessKeyId),
+		SecretAccessKey: aws.StringValue(p.creds.SecretAccessKey),
+		SessionToken:    aws.StringValue(p.creds.SessionToken),
+		ProviderName:    "aws-mfa",
+	}, nil
+}
+
+func (p *sessionProvider) IsExpired() bool {
+	return p.creds.Expiration != nil && time.Now().After(*p.creds.Expiration)
+}
+
+func (p *sessionProvider) ExpiresAt() time.Time {
+	return aws.TimeValue(p.creds.Expiration)
+}
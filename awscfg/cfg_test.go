@@ -0,0 +1,32 @@
+package awscfg
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestValidCode(t *testing.T) {
+	valid := []string{"000000", "000001", "100000", "123456"}
+	for _, c := range valid {
+		if !validCode(c) {
+			t.Errorf("expected code %q to be valid", c)
+		}
+	}
+
+	notValid := []string{"00000", "00000a", " 00000"}
+
+	for _, c := range notValid {
+		if validCode(c) {
+			t.Errorf("expected code %q not to be valid", c)
+		}
+	}
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "awscfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
@@ -0,0 +1,102 @@
+package awscfg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// ErrConsoleRequiresRole is returned by ConsoleURL for MFA session
+// credentials, which the federation endpoint does not accept.
+var ErrConsoleRequiresRole = errors.New("signing in to the console requires a role, set role_arn or role_chain")
+
+// consoleHosts are the federation and console hosts per partition.
+var consoleHosts = map[string]struct{ signin, console string }{
+	endpoints.AwsPartitionID:      {"signin.aws.amazon.com", "console.aws.amazon.com"},
+	endpoints.AwsUsGovPartitionID: {"signin.amazonaws-us-gov.com", "console.amazonaws-us-gov.com"},
+	endpoints.AwsCnPartitionID:    {"signin.amazonaws.cn", "console.amazonaws.cn"},
+}
+
+// ConsoleURL returns a URL signing in to the AWS console with the role
+// credentials of the configuration at path. The console opens service (e.g.
+// ec2, the console home if empty) in region (aws_default_region if empty).
+func ConsoleURL(path string, opts *Options, service, region string) (string, error) {
+	cfg, creds, err := loadCredentials(path, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(cfg.roleChain()) == 0 && (cfg.Type == "" || cfg.Type == typeIAMUser) {
+		return "", ErrConsoleRequiresRole
+	}
+	if region == "" {
+		region = cfg.AWSDefaultRegion
+	}
+	return consoleURL(cfg, creds, service, region)
+}
+
+func consoleURL(cfg *config, creds *sts.Credentials, service, region string) (string, error) {
+	hosts, ok := consoleHosts[cfg.partition()]
+	if !ok {
+		return "", fmt.Errorf("no console in partition %s", cfg.partition())
+	}
+	endpoint := "https://" + hosts.signin + "/federation"
+	if cfg.AWSFederationEndpoint != "" {
+		endpoint = cfg.AWSFederationEndpoint
+	}
+	token, err := signinToken(cfg, endpoint, creds)
+	if err != nil {
+		return "", err
+	}
+	if service == "" {
+		service = "console"
+	}
+	dest := "https://" + hosts.console + "/" + url.PathEscape(service) + "/home"
+	if region != "" {
+		dest += "?region=" + url.QueryEscape(region)
+	}
+	v := url.Values{
+		"Action":      {"login"},
+		"Issuer":      {"aws-mfa"},
+		"Destination": {dest},
+		"SigninToken": {token},
+	}
+	return endpoint + "?" + v.Encode(), nil
+}
+
+// signinToken exchanges creds for a sign-in token at the federation
+// endpoint.
+func signinToken(cfg *config, endpoint string, creds *sts.Credentials) (string, error) {
+	session, err := json.Marshal(map[string]string{
+		"sessionId":    *creds.AccessKeyId,
+		"sessionKey":   *creds.SecretAccessKey,
+		"sessionToken": *creds.SessionToken,
+	})
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{"Action": {"getSigninToken"}, "Session": {string(session)}}
+	// not using the debug transport, the URL contains the credentials
+	client := &http.Client{Timeout: 30 * time.Second}
+	rsp, err := client.Get(endpoint + "?" + v.Encode())
+	if err != nil {
+		return "", fmt.Errorf("getting sign-in token: %s", err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting sign-in token: federation endpoint returned %s", rsp.Status)
+	}
+	var res struct{ SigninToken string }
+	if err := json.NewDecoder(rsp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("getting sign-in token: %s", err)
+	}
+	if res.SigninToken == "" {
+		return "", errors.New("getting sign-in token: federation endpoint returned no token")
+	}
+	return res.SigninToken, nil
+}
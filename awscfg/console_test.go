@@ -0,0 +1,39 @@
+package awscfg
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestConsoleURL(t *testing.T) {
+	srv := newTestSTS(t)
+	defer srv.Close()
+
+	creds := &sts.Credentials{AccessKeyId: aws.String("ASIAROLE"), SecretAccessKey: aws.String("secret"), SessionToken: aws.String("token")}
+	cfg := &config{AWSFederationEndpoint: srv.URL, AWSDefaultRegion: "us-gov-west-1"}
+	s, err := consoleURL(cfg, creds, "ec2", "us-gov-west-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	tests := []struct{ Has, Want interface{} }{
+		{strings.Join(srv.requests, ","), "getSigninToken ASIAROLE"},
+		{strings.HasPrefix(s, srv.URL+"?"), true},
+		{q.Get("Action"), "login"},
+		{q.Get("SigninToken"), "signin-token"},
+		{q.Get("Destination"), "https://console.amazonaws-us-gov.com/ec2/home?region=us-gov-west-1"},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+}
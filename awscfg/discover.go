@@ -0,0 +1,192 @@
+package awscfg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FindConfig returns the path of the config to use: path if not empty,
+// $AWS_CREDENTIALS_PATH, $XDG_CONFIG_HOME/aws-mfa/config.*,
+// ~/.config/aws.*.json or the shared credentials file of the aws command
+// line tool, whichever is found first.
+func FindConfig(path string) (string, error) {
+	path, err := findConfig(path)
+	if err == nil {
+		dbg.Printf("using config %s", path)
+	}
+	return path, err
+}
+
+// FindConfigs returns the paths of all configs FindConfig considers.
+func FindConfigs() ([]string, error) {
+	if p := os.Getenv("AWS_CREDENTIALS_PATH"); p != "" {
+		return []string{p}, nil
+	}
+	home, _ := os.UserHomeDir()
+	paths := []string{}
+	for _, pattern := range configPatterns(home) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	if shared := sharedCredentialsPath(home); fileExists(shared) {
+		paths = append(paths, shared)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no config found, use --config or set AWS_CREDENTIALS_PATH")
+	}
+	return paths, nil
+}
+
+// configPatterns are the globs of configs of aws-mfa in the order they are
+// searched.
+func configPatterns(home string) []string {
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	return []string{
+		filepath.Join(xdg, "aws-mfa", "config.*"),
+		filepath.Join(home, ".config", "aws.*.json"),
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func findConfig(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	if p := os.Getenv("AWS_CREDENTIALS_PATH"); p != "" {
+		return p, nil
+	}
+	home, _ := os.UserHomeDir()
+	searched := []string{}
+	for _, pattern := range configPatterns(home) {
+		searched = append(searched, pattern)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return matches[0], nil
+		}
+		return "", fmt.Errorf("found multiple configs (%s), use --config or AWS_CREDENTIALS_PATH to choose one", strings.Join(matches, ", "))
+	}
+	shared := sharedCredentialsPath(home)
+	if fileExists(shared) {
+		return shared, nil
+	}
+	searched = append(searched, shared)
+	return "", fmt.Errorf("no config found in %s, use --config or set AWS_CREDENTIALS_PATH", strings.Join(searched, ", "))
+}
+
+func sharedCredentialsPath(home string) string {
+	if p := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); p != "" {
+		return p
+	}
+	return filepath.Join(home, ".aws", "credentials")
+}
+
+func sharedConfigPath(credentialsPath string) string {
+	if p := os.Getenv("AWS_CONFIG_FILE"); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(credentialsPath), "config")
+}
+
+// isSharedCredentials returns true for the shared credentials file of the
+// aws command line tool.
+func isSharedCredentials(path string) bool {
+	home, _ := os.UserHomeDir()
+	return path == sharedCredentialsPath(home) || (filepath.Base(path) == "credentials" && filepath.Base(filepath.Dir(path)) == ".aws")
+}
+
+// decodeSharedConfig reads the profile $AWS_PROFILE (or default) from the
+// shared credentials file at path and its region from the shared config.
+// Keys are named like in other configs, e.g. aws_access_key_id.
+func decodeSharedConfig(path string, b []byte, cfg *config) error {
+	creds, err := parseLocalConfig(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	return decodeSharedProfile(path, creds, sharedProfile(), cfg)
+}
+
+// sharedProfile returns the profile of the shared credentials file to use.
+func sharedProfile() string {
+	if p := os.Getenv("AWS_PROFILE"); p != "" {
+		return p
+	}
+	return "default"
+}
+
+// awsCLIKeys are settings of the aws command line tool which are no aws-mfa
+// settings. They are ignored in profiles of the shared credentials file.
+var awsCLIKeys = map[string]bool{
+	"aws_session_token": true, "aws_security_token": true, "aws_credential_expiration": true,
+	"output": true, "mfa_serial": true, "source_profile": true, "credential_source": true,
+	"credential_process": true, "external_id": true, "duration_seconds": true,
+	"sso_session": true, "sso_registration_scopes": true, "ca_bundle": true,
+	"cli_pager": true, "cli_timestamp_format": true, "cli_follow_urlparam": true,
+	"cli_binary_format": true, "cli_auto_prompt": true, "max_attempts": true,
+	"retry_mode": true, "parameter_validation": true, "tcp_keepalive": true,
+	"endpoint_url": true, "ignore_configure_endpoint_urls": true, "use_fips_endpoint": true,
+	"use_dualstack_endpoint": true, "sts_regional_endpoints": true, "s3": true,
+	"metadata_service_timeout": true, "metadata_service_num_attempts": true,
+	"services": true, "api_versions": true,
+}
+
+// decodeSharedProfile decodes the profile of the parsed shared credentials
+// file creds read from path. Settings of the aws command line tool are
+// ignored, region is used as aws_default_region.
+func decodeSharedProfile(path string, creds map[string]map[string]string, profile string, cfg *config) error {
+	section, ok := creds[profile]
+	if !ok {
+		return fmt.Errorf("%s: no profile %s found", path, profile)
+	}
+	values := map[string]*node{}
+	for k, v := range section {
+		if awsCLIKeys[k] || k == "region" {
+			continue
+		}
+		values[k] = &node{value: iniValue(v), raw: v}
+	}
+	if region := section["region"]; region != "" && values["aws_default_region"] == nil {
+		values["aws_default_region"] = &node{value: region}
+	}
+	if shared, err := parseConfigFile(sharedConfigPath(path)); err == nil {
+		name := "profile " + profile
+		if profile == "default" {
+			name = profile
+		}
+		if region := shared[name]["region"]; region != "" && values["aws_default_region"] == nil {
+			values["aws_default_region"] = &node{value: region}
+		}
+	}
+	return decodeNode("", &node{value: values}, reflect.ValueOf(cfg).Elem())
+}
+
+// iniValue returns v as an integer or bool if it is one.
+func iniValue(v string) interface{} {
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return i
+	}
+	if b, err := strconv.ParseBool(v); err == nil {
+		return b
+	}
+	return v
+}
@@ -0,0 +1,129 @@
+package awscfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setenv(t *testing.T, env map[string]string) func() {
+	old := map[string]string{}
+	for k, v := range env {
+		old[k] = os.Getenv(k)
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer setenv(t, map[string]string{
+		"HOME":                        dir,
+		"XDG_CONFIG_HOME":             "",
+		"AWS_CREDENTIALS_PATH":        "",
+		"AWS_SHARED_CREDENTIALS_FILE": "",
+	})()
+
+	if _, err := FindConfig(""); err == nil || !strings.Contains(err.Error(), "no config found") {
+		t.Errorf("expected no config to be found, was %v", err)
+	}
+
+	writeFiles(t, dir, map[string]string{".aws/credentials": "[default]\naws_access_key_id = key\n"})
+	writeFiles(t, dir, map[string]string{".config/aws.phraseapp.json": "{}"})
+	writeFiles(t, dir, map[string]string{".config/aws-mfa/config.yaml": ""})
+	os.Setenv("AWS_CREDENTIALS_PATH", "/env.json")
+	tests := []struct {
+		Remove string
+		Flag   string
+		Want   string
+	}{
+		{"", "/flag.json", "/flag.json"},
+		{"", "", "/env.json"},
+		{"", "", filepath.Join(dir, ".config/aws-mfa/config.yaml")},
+		{".config/aws-mfa/config.yaml", "", filepath.Join(dir, ".config/aws.phraseapp.json")},
+		{".config/aws.phraseapp.json", "", filepath.Join(dir, ".aws/credentials")},
+	}
+	for i, tc := range tests {
+		if i == 2 {
+			os.Setenv("AWS_CREDENTIALS_PATH", "")
+		}
+		if tc.Remove != "" {
+			os.Remove(filepath.Join(dir, tc.Remove))
+		}
+		p, err := FindConfig(tc.Flag)
+		if err != nil {
+			t.Errorf("%d: %s", i+1, err)
+		} else if p != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, p)
+		}
+	}
+
+	writeFiles(t, dir, map[string]string{".config/aws.a.json": "{}", ".config/aws.b.json": "{}"})
+	if _, err := FindConfig(""); err == nil || !strings.Contains(err.Error(), "multiple configs") {
+		t.Errorf("expected multiple configs error, was %v", err)
+	}
+}
+
+func TestReadSharedConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer setenv(t, map[string]string{"HOME": dir, "AWS_PROFILE": "work", "AWS_SHARED_CREDENTIALS_FILE": "", "AWS_CONFIG_FILE": ""})()
+	writeFiles(t, dir, map[string]string{
+		".aws/credentials": "[default]\naws_access_key_id = default\n\n[work]\naws_access_key_id = key\naws_secret_access_key = secret\naws_mfa_attempts = 5\n" +
+			"\n[cli]\naws_access_key_id = key\naws_session_token = token\nregion = eu-central-1\nmfa_serial = arn:aws:iam::123456789012:mfa/me\noutput = json\n" +
+			"\n[typo]\naws_yubi_key = aws\n" +
+			"\n[account]\naws_access_key_id = key\naws_account_name = 012345678901\n",
+		".aws/config": "[profile work]\nregion = eu-west-1\n",
+	})
+	cfg, err := readConfigFromFile(filepath.Join(dir, ".aws/credentials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{cfg.AWSAccessKeyID, "key"},
+		{cfg.AWSSecretAccessKey, "secret"},
+		{cfg.AWSMFAAttempts, 5},
+		{cfg.AWSDefaultRegion, "eu-west-1"},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+
+	// settings of the aws command line tool are ignored, typos are not
+	os.Setenv("AWS_PROFILE", "cli")
+	if cfg, err = readConfigFromFile(filepath.Join(dir, ".aws/credentials")); err != nil || cfg.AWSDefaultRegion != "eu-central-1" {
+		t.Errorf("expected profile with aws settings to be read, was %#v %v", cfg, err)
+	}
+	// numbers are kept as written
+	os.Setenv("AWS_PROFILE", "account")
+	if cfg, err = readConfigFromFile(filepath.Join(dir, ".aws/credentials")); err != nil || cfg.AWSAccountName != "012345678901" {
+		t.Errorf("expected account id with leading zero, was %#v %v", cfg, err)
+	}
+	os.Setenv("AWS_PROFILE", "typo")
+	if _, err = readConfigFromFile(filepath.Join(dir, ".aws/credentials")); err == nil || !strings.Contains(err.Error(), `unknown field "aws_yubi_key"`) {
+		t.Errorf("expected unknown field error, was %v", err)
+	}
+}
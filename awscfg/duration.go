@@ -0,0 +1,101 @@
+package awscfg
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// durationLimits are the minimum and maximum duration STS accepts for a kind
+// of session.
+type durationLimits struct {
+	name     string
+	min, max time.Duration
+}
+
+var (
+	sessionTokenLimits = durationLimits{"session tokens", 15 * time.Minute, 36 * time.Hour}
+	roleLimits         = durationLimits{"role sessions", 15 * time.Minute, 12 * time.Hour}
+	chainedRoleLimits  = durationLimits{"role sessions assumed by role chaining", 15 * time.Minute, 1 * time.Hour}
+	federationLimits   = durationLimits{"federated sessions", 15 * time.Minute, 36 * time.Hour}
+)
+
+// check returns an error when d is out of range. With clamp, the closest
+// duration in range is returned instead. setting names the configured value
+// in messages.
+func (l durationLimits) check(setting string, d time.Duration, clamp bool) (time.Duration, error) {
+	v := d
+	if v < l.min {
+		v = l.min
+	} else if v > l.max {
+		v = l.max
+	}
+	if v == d {
+		return d, nil
+	}
+	if !clamp {
+		return 0, fmt.Errorf("%s %s is out of range, %s last between %s and %s (use --auto-clamp to use %s)",
+			setting, formatDuration(d), l.name, formatDuration(l.min), formatDuration(l.max), formatDuration(v))
+	}
+	fmt.Fprintf(os.Stderr, "%s %s is out of range for %s, using %s\n", setting, formatDuration(d), l.name, formatDuration(v))
+	return v, nil
+}
+
+var daysPrefix = regexp.MustCompile(`^(\d+)d`)
+
+// parseDuration is like time.ParseDuration but also accepts days, e.g. "1d"
+// or "1d12h".
+func parseDuration(s string) (time.Duration, error) {
+	var days time.Duration
+	if m := daysPrefix.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		if s = s[len(m[0]):]; s == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return days + d, nil
+}
+
+// formatDuration formats d without trailing zero units, e.g. "36h" instead
+// of "36h0m0s".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// maxRoleDuration returns the MaxSessionDuration of the role with ARN arn.
+// The role is only found when it is in the account of the credentials of
+// awsCfg and they are allowed to call iam:GetRole.
+func maxRoleDuration(awsCfg *aws.Config, arn string) (time.Duration, bool) {
+	name := arn[strings.LastIndex(arn, "/")+1:]
+	res, err := iam.New(session.New(awsCfg)).GetRole(&iam.GetRoleInput{RoleName: aws.String(name)})
+	if err != nil {
+		dbg.Printf("error getting role %s: %s", name, err)
+		return 0, false
+	}
+	if res.Role.Arn == nil || *res.Role.Arn != arn || res.Role.MaxSessionDuration == nil {
+		return 0, false
+	}
+	return time.Duration(*res.Role.MaxSessionDuration) * time.Second, true
+}
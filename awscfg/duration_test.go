@@ -0,0 +1,63 @@
+package awscfg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		Has  string
+		Want time.Duration
+	}{
+		{"6h", 6 * time.Hour},
+		{"1d", 24 * time.Hour},
+		{"1d12h", 36 * time.Hour},
+		{"90m", 90 * time.Minute},
+	}
+	for i, tc := range tests {
+		d, err := parseDuration(tc.Has)
+		if err != nil {
+			t.Errorf("%d: %s", i+1, err)
+		} else if d != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, d)
+		}
+	}
+	for _, s := range []string{"", "d", "1x", "1d1d"} {
+		if _, err := parseDuration(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestDurationLimits(t *testing.T) {
+	tests := []struct {
+		Limits durationLimits
+		Has    time.Duration
+		Want   time.Duration
+	}{
+		{sessionTokenLimits, 12 * time.Hour, 12 * time.Hour},
+		{sessionTokenLimits, 48 * time.Hour, 36 * time.Hour},
+		{sessionTokenLimits, 10 * time.Minute, 15 * time.Minute},
+		{roleLimits, 24 * time.Hour, 12 * time.Hour},
+		{chainedRoleLimits, 2 * time.Hour, time.Hour},
+	}
+	for i, tc := range tests {
+		d, err := tc.Limits.check("duration", tc.Has, true)
+		if err != nil {
+			t.Errorf("%d: %s", i+1, err)
+		} else if d != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, d)
+		}
+		_, err = tc.Limits.check("duration", tc.Has, false)
+		if (err != nil) != (tc.Has != tc.Want) {
+			t.Errorf("%d: unexpected error %v", i+1, err)
+		}
+	}
+
+	_, err := sessionTokenLimits.check("aws_duration", 48*time.Hour, false)
+	if err == nil || !strings.Contains(err.Error(), "aws_duration 48h is out of range, session tokens last between 15m and 36h") {
+		t.Errorf("expected friendly error, was %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package awscfg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// Configs can be encrypted with OpenPGP, e.g. with gpg --symmetric or
+// gpg --encrypt, or with age. They are decrypted in memory with
+// $AWS_MFA_DECRYPT_COMMAND, which reads the encrypted config from stdin and
+// prints it decrypted. OpenPGP configs can also be decrypted with the secret
+// key in $AWS_MFA_KEY_FILE or a passphrase.
+const (
+	decryptCommandEnv = "AWS_MFA_DECRYPT_COMMAND"
+	encryptCommandEnv = "AWS_MFA_ENCRYPT_COMMAND"
+	keyFileEnv        = "AWS_MFA_KEY_FILE"
+)
+
+// encryptedExts are the extensions of encrypted configs. The extension
+// before them is used to detect the format.
+var encryptedExts = []string{".gpg", ".pgp", ".asc", ".age"}
+
+const (
+	armorHeader    = "-----BEGIN PGP MESSAGE-----"
+	ageHeader      = "age-encryption.org/v1"
+	ageArmorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+)
+
+// isEncrypted returns true if b is encrypted with age or is an OpenPGP
+// message encrypted with a passphrase or a public key.
+func isEncrypted(b []byte) bool {
+	if isAge(b) || bytes.HasPrefix(bytes.TrimSpace(b), []byte(armorHeader)) {
+		return true
+	}
+	if len(b) == 0 || b[0]&0x80 == 0 {
+		return false
+	}
+	tag := b[0] & 0x3f
+	if b[0]&0x40 == 0 {
+		// old packet format
+		tag = (b[0] >> 2) & 0xf
+	}
+	// public key or symmetric key encrypted session key
+	return tag == 1 || tag == 3
+}
+
+// isAge returns true if b is a binary or armored age file.
+func isAge(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(ageHeader+"\n")) || bytes.HasPrefix(bytes.TrimSpace(b), []byte(ageArmorHeader))
+}
+
+// trimEncryptedExt returns path without the extension of encrypted configs.
+func trimEncryptedExt(path string) string {
+	for _, ext := range encryptedExts {
+		if strings.HasSuffix(path, ext) {
+			return strings.TrimSuffix(path, ext)
+		}
+	}
+	return path
+}
+
+// encryption is how a config was encrypted, so it can be encrypted the same
+// way after editing.
+type encryption struct {
+	armored    bool
+	command    bool
+	passphrase []byte
+	keys       openpgp.EntityList
+}
+
+// decryptConfig decrypts the encrypted config b read from path. Passphrases
+// are asked for with p.
+func decryptConfig(ctx context.Context, path string, b []byte, p prompter) ([]byte, *encryption, error) {
+	enc := &encryption{armored: bytes.HasPrefix(bytes.TrimSpace(b), []byte(armorHeader))}
+	if cmd := os.Getenv(decryptCommandEnv); cmd != "" {
+		enc.command = true
+		out, err := runFilterCommand(ctx, cmd, b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decrypting %s: %s", path, err)
+		}
+		return out, enc, nil
+	}
+	if isAge(b) {
+		return nil, nil, fmt.Errorf("decrypting %s: set %s to a command decrypting age files, e.g. age --decrypt --identity ~/.config/age/key.txt", path, decryptCommandEnv)
+	}
+	if keyFile := os.Getenv(keyFileEnv); keyFile != "" {
+		keys, err := readKeyFile(keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		enc.keys = keys
+	}
+	var r io.Reader = bytes.NewReader(b)
+	if enc.armored {
+		block, err := armor.Decode(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decrypting %s: %s", path, err)
+		}
+		r = block.Body
+	}
+	asked := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if asked {
+			return nil, errors.New("wrong passphrase")
+		}
+		asked = true
+		if symmetric {
+			passphrase, err := p.prompt(ctx, "Passphrase of "+path, true)
+			enc.passphrase = []byte(passphrase)
+			return enc.passphrase, err
+		}
+		passphrase, err := p.prompt(ctx, "Passphrase of the key in "+os.Getenv(keyFileEnv), true)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			if k.PrivateKey != nil && k.PrivateKey.Encrypted {
+				k.PrivateKey.Decrypt([]byte(passphrase))
+			}
+		}
+		return nil, nil
+	}
+	md, err := openpgp.ReadMessage(r, enc.keys, prompt, nil)
+	if err == nil {
+		var out []byte
+		if out, err = ioutil.ReadAll(md.UnverifiedBody); err == nil {
+			return out, enc, nil
+		}
+	}
+	if len(enc.keys) == 0 && !asked {
+		return nil, nil, fmt.Errorf("decrypting %s: %s, set %s to the secret key or %s to a command decrypting it, e.g. gpg --quiet --decrypt", path, err, keyFileEnv, decryptCommandEnv)
+	}
+	return nil, nil, fmt.Errorf("decrypting %s: %s", path, err)
+}
+
+// readKeyFile reads the armored or binary secret keys at path.
+func readKeyFile(path string) (openpgp.EntityList, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys openpgp.EntityList
+	if bytes.Contains(b, []byte("-----BEGIN PGP")) {
+		keys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+	} else {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s %s: %s", keyFileEnv, path, err)
+	}
+	return keys, nil
+}
+
+// encrypt encrypts the config b like the one it was decrypted from: with
+// $AWS_MFA_ENCRYPT_COMMAND if it was decrypted with a command, otherwise
+// with the same passphrase or to the same keys.
+func (e *encryption) encrypt(ctx context.Context, b []byte) ([]byte, error) {
+	if e.command {
+		cmd := os.Getenv(encryptCommandEnv)
+		if cmd == "" {
+			return nil, fmt.Errorf("set %s to a command encrypting the config, e.g. gpg --encrypt --default-recipient-self", encryptCommandEnv)
+		}
+		return runFilterCommand(ctx, cmd, b)
+	}
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser = nopCloser{buf}
+	if e.armored {
+		var err error
+		if w, err = armor.Encode(buf, "PGP MESSAGE", nil); err != nil {
+			return nil, err
+		}
+	}
+	var plain io.WriteCloser
+	var err error
+	if e.passphrase != nil {
+		plain, err = openpgp.SymmetricallyEncrypt(w, e.passphrase, nil, nil)
+	} else {
+		plain, err = openpgp.Encrypt(w, e.keys, nil, nil, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := plain.Write(b); err != nil {
+		return nil, err
+	}
+	if err := plain.Close(); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if e.armored {
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// runFilterCommand runs cmd with sh, writing in to its stdin, and returns
+// its output.
+func runFilterCommand(ctx context.Context, cmd string, in []byte) ([]byte, error) {
+	c := exec.CommandContext(ctx, "sh", "-c", cmd)
+	c.Stdin = bytes.NewReader(in)
+	stderr := &bytes.Buffer{}
+	c.Stderr = stderr
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running %q: %s: %s", cmd, err, stderr)
+	}
+	return out, nil
+}
+
+// EditConfig opens the config at path in $VISUAL or $EDITOR (vi by default).
+// Encrypted configs are decrypted to a private temporary file, which is
+// removed afterwards. The edited config is validated before it replaces the
+// config and encrypted again.
+func EditConfig(path string) error {
+	ctx := context.Background()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	plain, enc := b, (*encryption)(nil)
+	if isEncrypted(b) {
+		if plain, enc, err = decryptConfig(ctx, path, b, newPrompter(&config{})); err != nil {
+			return err
+		}
+	}
+	dir, err := ioutil.TempDir("", "aws-mfa")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, filepath.Base(trimEncryptedExt(path)))
+	if err := ioutil.WriteFile(tmp, plain, 0600); err != nil {
+		return err
+	}
+	term := newTerminalPrompter(os.Stdin, os.Stderr)
+	var edited []byte
+	for {
+		if err := runEditor(tmp); err != nil {
+			return err
+		}
+		if edited, err = ioutil.ReadFile(tmp); err != nil {
+			return err
+		}
+		if bytes.Equal(edited, plain) {
+			fmt.Fprintln(os.Stderr, "no changes")
+			return nil
+		}
+		err := validateConfig(path, edited)
+		if err == nil {
+			break
+		}
+		fmt.Fprintln(os.Stderr, err)
+		answer, perr := term.prompt(ctx, "edit again? [Y/n]", false)
+		if perr != nil || strings.HasPrefix(strings.ToLower(answer), "n") {
+			return errors.New("config not saved")
+		}
+	}
+	out := edited
+	if enc != nil {
+		if out, err = enc.encrypt(ctx, edited); err != nil {
+			return err
+		}
+	}
+	return replaceFile(path, out)
+}
+
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	c := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("running %s: %s", editor, err)
+	}
+	return nil
+}
+
+// replaceFile replaces the file at path with b, keeping its mode.
+func replaceFile(path string, b []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
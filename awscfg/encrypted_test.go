@@ -0,0 +1,126 @@
+package awscfg
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// passphrasePrompter answers every prompt with its passphrase.
+type passphrasePrompter string
+
+func (p passphrasePrompter) prompt(ctx context.Context, msg string, secret bool) (string, error) {
+	return string(p), nil
+}
+
+func (p passphrasePrompter) notify(ctx context.Context, msg string) {
+}
+
+func TestEncryptedConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer setenv(t, map[string]string{decryptCommandEnv: "", keyFileEnv: ""})()
+	ctx := context.Background()
+
+	plain := []byte("aws_access_key_id: key\naws_secret_access_key: secret\n")
+	for i, armored := range []bool{false, true} {
+		b, err := (&encryption{armored: armored, passphrase: []byte("pass")}).encrypt(ctx, plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isEncrypted(b) || bytes.Contains(b, []byte("secret")) {
+			t.Errorf("%d: expected config to be encrypted, was %q", i+1, b)
+		}
+		has, enc, err := decryptConfig(ctx, "config.gpg", b, passphrasePrompter("pass"))
+		if err != nil {
+			t.Fatalf("%d: %s", i+1, err)
+		}
+		if !bytes.Equal(has, plain) || enc.armored != armored || string(enc.passphrase) != "pass" {
+			t.Errorf("%d: unexpected config %q decrypted with %#v", i+1, has, enc)
+		}
+		if _, _, err := decryptConfig(ctx, "config.gpg", b, passphrasePrompter("wrong")); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+			t.Errorf("%d: expected error of wrong passphrase, was %v", i+1, err)
+		}
+	}
+
+	// the format is detected by the extension before the one of encrypted
+	// configs
+	b, _ := (&encryption{passphrase: []byte("pass")}).encrypt(ctx, []byte("aws_access_key_id = \"key\"\naws_secret_access_key = \"secret\"\n"))
+	path := filepath.Join(dir, "config.toml.gpg")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer setenv(t, map[string]string{decryptCommandEnv: "cat >/dev/null; printf 'aws_access_key_id = \"key\"\\n'"})()
+	cfg, err := readConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWSAccessKeyID != "key" {
+		t.Errorf("unexpected config %#v", cfg)
+	}
+
+	// age files can only be decrypted with the command
+	path = filepath.Join(dir, "config.toml.age")
+	if err := ioutil.WriteFile(path, []byte("age-encryption.org/v1\n-> X25519 abc\n--- def\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = readConfigFromFile(path); err != nil || cfg.AWSAccessKeyID != "key" {
+		t.Errorf("expected age config to be decrypted with the command, was %#v %v", cfg, err)
+	}
+	defer setenv(t, map[string]string{decryptCommandEnv: ""})()
+	if _, err := readConfigFromFile(path); err == nil || !strings.Contains(err.Error(), decryptCommandEnv) {
+		t.Errorf("expected error without decrypt command, was %v", err)
+	}
+}
+
+func TestIsEncrypted(t *testing.T) {
+	tests := []struct {
+		Has  string
+		Want bool
+	}{
+		{"{}", false},
+		{"aws_access_key_id: key", false},
+		{"-----BEGIN PGP MESSAGE-----\n\njA0ECQMC\n", true},
+		{"\x8c\x0d\x04\x09", true},  // symmetric key encrypted session key, old format
+		{"\xc3\x0d\x04\x09", true},  // same in the new format
+		{"\x85\x01\x0c\x03", true},  // public key encrypted session key
+		{"\xa3\x01\x78\x9c", false}, // compressed data
+		{"age-encryption.org/v1\n-> X25519 abc\n", true},
+		{"-----BEGIN AGE ENCRYPTED FILE-----\nYWdlLWVu\n", true},
+		{"age-encryption.org: key", false},
+	}
+	for i, tc := range tests {
+		if has := isEncrypted([]byte(tc.Has)); has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, has)
+		}
+	}
+}
+
+func TestEditConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("aws_access_key_id: key\naws_secret_access_key: s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer setenv(t, map[string]string{"VISUAL": "", "EDITOR": "sed -i s/s3cr3t/changed/"})()
+	if err := EditConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(path); !strings.Contains(string(b), "changed") {
+		t.Errorf("expected edited config, was %q", b)
+	}
+
+	// invalid configs are not saved
+	defer setenv(t, map[string]string{"EDITOR": "sed -i s/aws_access_key_id/aws_acces_key_id/"})()
+	if err := EditConfig(path); err == nil || err.Error() != "config not saved" {
+		t.Errorf("expected error, was %v", err)
+	}
+	if b, _ := ioutil.ReadFile(path); !strings.Contains(string(b), "aws_access_key_id") {
+		t.Errorf("expected config not to change, was %q", b)
+	}
+}
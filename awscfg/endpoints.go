@@ -0,0 +1,64 @@
+package awscfg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// stsConfig returns the config of STS clients using creds.
+func stsConfig(cfg *config, creds *credentials.Credentials) *aws.Config {
+	awsCfg := clientConfig(cfg, creds)
+	if cfg.AWSSTSEndpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.AWSSTSEndpoint)
+	}
+	if cfg.AWSSTSRegionalEndpoints {
+		awsCfg = awsCfg.WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint)
+	}
+	return awsCfg
+}
+
+// iamConfig returns the config of IAM clients using creds.
+func iamConfig(cfg *config, creds *credentials.Credentials) *aws.Config {
+	awsCfg := clientConfig(cfg, creds)
+	if cfg.AWSIAMEndpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.AWSIAMEndpoint)
+	}
+	return awsCfg
+}
+
+// partition returns the partition of aws_default_region, e.g. aws-us-gov or
+// aws-cn. It is aws when no or an unknown region is configured.
+func (cfg *config) partition() string {
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), cfg.AWSDefaultRegion); ok && cfg.AWSDefaultRegion != "" {
+		return p.ID()
+	}
+	return endpoints.AwsPartitionID
+}
+
+var (
+	shortRoleARN = regexp.MustCompile(`^\d{12}:role/.+$`)
+	arnPartition = regexp.MustCompile(`^arn:([^:]+):`)
+)
+
+// roleARN returns the ARN of role. Roles may also be given without prefix,
+// e.g. 123456789012:role/admin, the ARN is then derived using the partition
+// of the configured region. Full ARNs must be in that partition.
+func roleARN(cfg *config, role string) (string, error) {
+	p := cfg.partition()
+	if shortRoleARN.MatchString(role) {
+		return "arn:" + p + ":iam::" + role, nil
+	}
+	m := arnPartition.FindStringSubmatch(role)
+	if m == nil || !strings.Contains(role, ":role/") {
+		return "", fmt.Errorf("invalid role %q, expected e.g. arn:%s:iam::123456789012:role/admin", role, p)
+	}
+	if m[1] != p {
+		return "", fmt.Errorf("role %s is not in partition %s of region %s", role, p, cfg.AWSDefaultRegion)
+	}
+	return role, nil
+}
@@ -0,0 +1,56 @@
+package awscfg
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoleARN(t *testing.T) {
+	tests := []struct {
+		Region string
+		Role   string
+		Want   string
+	}{
+		{"", "arn:aws:iam::123456789012:role/admin", "arn:aws:iam::123456789012:role/admin"},
+		{"eu-west-1", "123456789012:role/admin", "arn:aws:iam::123456789012:role/admin"},
+		{"us-gov-west-1", "123456789012:role/admin", "arn:aws-us-gov:iam::123456789012:role/admin"},
+		{"cn-north-1", "123456789012:role/path/admin", "arn:aws-cn:iam::123456789012:role/path/admin"},
+		{"us-gov-west-1", "arn:aws:iam::123456789012:role/admin", ""},
+		{"", "admin", ""},
+	}
+	for i, tc := range tests {
+		arn, err := roleARN(&config{AWSDefaultRegion: tc.Region}, tc.Role)
+		if tc.Want == "" {
+			if err == nil {
+				t.Errorf("%d: expected error, was %q", i+1, arn)
+			}
+		} else if arn != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v err=%v", i+1, tc.Want, arn, err)
+		}
+	}
+}
+
+func TestSTSEndpoint(t *testing.T) {
+	srv := newTestSTS(t)
+	defer srv.Close()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "config.json")
+	cfg := `{"aws_access_key_id": "AKIA", "aws_secret_access_key": "secret", "aws_default_region": "eu-west-1", "aws_sts_endpoint": "` + srv.URL + `"}`
+	if err := ioutil.WriteFile(path, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	awsCfg, err := Federate(path, nil, "contractor", "", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := awsCfg.Credentials.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "ASIAFEDERATED" || len(srv.requests) != 1 {
+		t.Errorf("expected credentials from the configured endpoint, was %q after %q", creds.AccessKeyID, srv.requests)
+	}
+}
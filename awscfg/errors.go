@@ -0,0 +1,65 @@
+package awscfg
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// defaultMaxRetries is the number of times throttled and otherwise
+// retryable STS and IAM calls are retried.
+const defaultMaxRetries = 3
+
+// withRetries makes clients using awsCfg retry retryable errors with
+// jittered exponential backoff, bounded to a few seconds per retry.
+func withRetries(cfg *config, awsCfg *aws.Config) *aws.Config {
+	retries := defaultMaxRetries
+	if cfg.AWSMaxRetries > 0 {
+		retries = cfg.AWSMaxRetries
+	}
+	return request.WithRetryer(awsCfg, client.DefaultRetryer{
+		NumMaxRetries:    retries,
+		MinRetryDelay:    100 * time.Millisecond,
+		MaxRetryDelay:    2 * time.Second,
+		MinThrottleDelay: 500 * time.Millisecond,
+		MaxThrottleDelay: 5 * time.Second,
+	})
+}
+
+// accessDeniedHints tell what to check when a call is denied.
+var accessDeniedHints = map[string]string{
+	"iam:ListMFADevices":     "your IAM policy must allow iam:ListMFADevices without MFA (see the IAM policy in the README)",
+	"sts:GetSessionToken":    "your IAM policy must allow sts:GetSessionToken without MFA (see the IAM policy in the README)",
+	"sts:AssumeRole":         "check that the role trusts your user and that your policy allows assuming it",
+	"sts:GetFederationToken": "your IAM policy must allow sts:GetFederationToken",
+}
+
+// explainError translates common errors returned by STS and IAM when
+// calling op (e.g. sts:AssumeRole) into messages telling what to do.
+func explainError(cfg *config, op string, err error) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return fmt.Errorf("%s: %s", op, err)
+	}
+	dbg.Printf("%s: %s", op, err)
+	switch aerr.Code() {
+	case "InvalidClientTokenId":
+		return fmt.Errorf("%s: the access key %s is not valid, it was probably deactivated or deleted. Create a new access key and update aws_access_key_id and aws_secret_access_key", op, cfg.AWSAccessKeyID)
+	case "SignatureDoesNotMatch":
+		return fmt.Errorf("%s: aws_secret_access_key does not belong to the access key %s, please check your config", op, cfg.AWSAccessKeyID)
+	case "ExpiredToken", "UnauthorizedException":
+		return fmt.Errorf("%s: the session expired or was revoked, remove the cached credentials in %s and try again", op, cacheDir)
+	case "RequestExpired":
+		return fmt.Errorf("%s: the request expired, please check that your clock is correct", op)
+	case "AccessDenied":
+		if hint, ok := accessDeniedHints[op]; ok {
+			return fmt.Errorf("%s: access denied, %s: %s", op, hint, aerr.Message())
+		}
+		return fmt.Errorf("%s: access denied: %s", op, aerr.Message())
+	}
+	return fmt.Errorf("%s: %s: %s", op, aerr.Code(), aerr.Message())
+}
@@ -0,0 +1,53 @@
+package awscfg
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestExplainError(t *testing.T) {
+	cfg := &config{AWSAccessKeyID: "AKIAEXAMPLE"}
+	tests := []struct {
+		Op   string
+		Err  error
+		Want string
+	}{
+		{"iam:ListMFADevices", awserr.New("InvalidClientTokenId", "The security token included in the request is invalid.", nil), "the access key AKIAEXAMPLE is not valid"},
+		{"iam:ListMFADevices", awserr.New("SignatureDoesNotMatch", "", nil), "aws_secret_access_key does not belong to the access key AKIAEXAMPLE"},
+		{"sts:AssumeRole", awserr.New("ExpiredToken", "", nil), "remove the cached credentials in /tmp/aws"},
+		{"iam:ListMFADevices", awserr.New("AccessDenied", "not authorized", nil), "must allow iam:ListMFADevices without MFA"},
+		{"sts:AssumeRole", awserr.New("AccessDenied", "not authorized", nil), "check that the role trusts your user"},
+		{"sts:AssumeRole", awserr.New("ValidationError", "bad input", nil), "sts:AssumeRole: ValidationError: bad input"},
+		{"sts:AssumeRole", errors.New("dial tcp: timeout"), "sts:AssumeRole: dial tcp: timeout"},
+	}
+	for i, tc := range tests {
+		if err := explainError(cfg, tc.Op, tc.Err); !strings.Contains(err.Error(), tc.Want) {
+			t.Errorf("%d: expected %q to contain %q", i+1, err, tc.Want)
+		}
+	}
+}
+
+func TestRetryThrottling(t *testing.T) {
+	srv := newTestSTS(t)
+	defer srv.Close()
+	srv.throttle = 1
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "config.json")
+	cfg := `{"aws_access_key_id": "AKIA", "aws_secret_access_key": "secret", "aws_default_region": "eu-west-1", "aws_sts_endpoint": "` + srv.URL + `"}`
+	if err := ioutil.WriteFile(path, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Federate(path, nil, "contractor", "", "1h"); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.requests) != 2 {
+		t.Errorf("expected throttled request to be retried once, was %q", srv.requests)
+	}
+}
@@ -0,0 +1,60 @@
+package awscfg
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// FederationWarning explains the limits of federated sessions.
+const FederationWarning = "federation tokens can not carry MFA context, APIs requiring MFA deny access to the session"
+
+// federatedUserName matches the names GetFederationToken accepts.
+var federatedUserName = regexp.MustCompile(`^[\w+=,.@-]{2,32}$`)
+
+// Federate returns the config of a federated user session named name which
+// is created with the IAM user keys read from path and overridden by opts.
+// The permissions of the session are the intersection of the ones of the IAM
+// user and policy (an inline JSON policy or the path of a file containing
+// one). Without a policy the session has no permissions. The session is not
+// cached.
+func Federate(path string, opts *Options, name, policy, duration string) (*aws.Config, error) {
+	if !federatedUserName.MatchString(name) {
+		return nil, fmt.Errorf("invalid name %q, use 2 to 32 letters, digits or +=,.@_-", name)
+	}
+	cfg, _, err := resolveConfig(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.check(path); err != nil {
+		return nil, err
+	}
+	if err := cfg.resolveAccessKey(); err != nil {
+		return nil, err
+	}
+	dur, err := parseDuration(duration)
+	if err != nil {
+		return nil, err
+	}
+	if dur, err = federationLimits.check("duration", dur, cfg.AWSAutoClamp); err != nil {
+		return nil, err
+	}
+	in := &sts.GetFederationTokenInput{
+		Name:            aws.String(name),
+		DurationSeconds: aws.Int64(int64(dur.Seconds())),
+	}
+	if policy != "" {
+		if policy, err = readPolicy(policy); err != nil {
+			return nil, err
+		}
+		in.Policy = aws.String(policy)
+	}
+	res, err := sts.New(session.New(stsConfig(cfg, staticCredentials(cfg)))).GetFederationToken(in)
+	if err != nil {
+		return nil, explainError(cfg, "sts:GetFederationToken", err)
+	}
+	return awsConfig(cfg, res.Credentials), nil
+}
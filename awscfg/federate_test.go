@@ -0,0 +1,62 @@
+package awscfg
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFederate(t *testing.T) {
+	srv := newTestSTS(t)
+	defer srv.Close()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "config.json")
+	cfg := `{"aws_access_key_id": "AKIA", "aws_secret_access_key": "secret", "aws_default_region": "eu-west-1", "aws_sts_endpoint": "` + srv.URL + `"}`
+	if err := ioutil.WriteFile(path, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	awsCfg, err := Federate(path, nil, "alice@example.com", `{"Version": "2012-10-17"}`, "12h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := awsCfg.Credentials.Get()
+	if err != nil || creds.AccessKeyID != "ASIAFEDERATED" || creds.SessionToken != "token" {
+		t.Errorf("unexpected credentials %v %v", creds, err)
+	}
+	if want := "GetFederationToken AKIA alice@example.com"; len(srv.requests) != 1 || srv.requests[0] != want {
+		t.Errorf("want=%q has=%q", want, srv.requests)
+	} else if f := srv.forms[0]; f.Get("DurationSeconds") != "43200" || f.Get("Policy") != `{"Version": "2012-10-17"}` {
+		t.Errorf("unexpected duration %s or policy %s", f.Get("DurationSeconds"), f.Get("Policy"))
+	}
+
+	tests := []struct {
+		Name, Policy, Duration string
+		Want                   string
+	}{
+		{"a", "", "1h", `invalid name "a"`},
+		{"contractor-with-a-very-long-name-1", "", "1h", "invalid name"},
+		{"alice smith", "", "1h", "invalid name"},
+		{"contractor", "", "10m", "duration 10m is out of range"},
+		{"contractor", "{", "1h", "policy is not valid JSON"},
+		{"contractor", filepath.Join(dir, "missing.json"), "1h", "reading policy"},
+	}
+	for i, tc := range tests {
+		if _, err := Federate(path, nil, tc.Name, tc.Policy, tc.Duration); err == nil || !strings.Contains(err.Error(), tc.Want) {
+			t.Errorf("%d: expected error containing %q, was %v", i+1, tc.Want, err)
+		}
+	}
+	if len(srv.requests) != 1 {
+		t.Errorf("expected invalid input not to be sent, was %q", srv.requests)
+	}
+
+	if _, err := Federate(path, &Options{AutoClamp: true}, "contractor", "", "10m"); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.forms) != 2 || srv.forms[1].Get("DurationSeconds") != "900" {
+		t.Errorf("expected a clamped 15m session, was %q", srv.requests)
+	}
+}
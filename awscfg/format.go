@@ -0,0 +1,407 @@
+package awscfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of config files.
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatTOML = "toml"
+	// formatShared is the shared credentials file of the aws command line
+	// tool.
+	formatShared = "shared"
+)
+
+var tomlKeyValue = regexp.MustCompile(`(?m)^\s*(\[[\w."-]+\]|[\w"-]+\s*=)`)
+
+// configFormat returns the format of a config file by its extension or, for
+// other extensions, by its content. Extensions of encrypted configs are
+// ignored.
+func configFormat(path string, b []byte) string {
+	path = trimEncryptedExt(path)
+	if isSharedCredentials(path) {
+		return formatShared
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".toml":
+		return formatTOML
+	}
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")):
+		return formatJSON
+	case tomlKeyValue.Match(b):
+		return formatTOML
+	}
+	return formatYAML
+}
+
+// configError is an error at a position of a config file. col is 0 when
+// the column is not known, line when the position is not known at all.
+type configError struct {
+	path      string
+	line, col int
+	msg       string
+}
+
+func (e *configError) Error() string {
+	switch {
+	case e.line == 0:
+		return fmt.Sprintf("%s: %s", e.path, e.msg)
+	case e.col > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", e.path, e.line, e.col, e.msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.path, e.line, e.msg)
+}
+
+// decodeConfig decodes the config file read from path into cfg. JSON, YAML
+// and TOML use the same field names.
+func decodeConfig(path string, b []byte, cfg *config) error {
+	var err error
+	switch configFormat(path, b) {
+	case formatShared:
+		err = decodeSharedConfig(path, b, cfg)
+	case formatJSON:
+		err = decodeJSON(b, cfg)
+	case formatYAML:
+		err = decodeYAML(b, cfg)
+	case formatTOML:
+		err = decodeTOML(b, cfg)
+	}
+	if cerr, ok := err.(*configError); ok {
+		cerr.path = path
+	}
+	return err
+}
+
+var jsonUnknownField = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+func decodeJSON(b []byte, cfg *config) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	err := d.Decode(cfg)
+	if m := jsonUnknownField.FindStringSubmatch(fmt.Sprint(err)); m != nil {
+		// the decoder reports neither the position nor the parent of the
+		// field, so the first occurrence of the key is reported
+		names := append(fieldNames(reflect.TypeOf(config{})), fieldNames(reflect.TypeOf(roleHop{}))...)
+		line, col := 0, 0
+		if i := bytes.Index(b, []byte(strconv.Quote(m[1]))); i >= 0 {
+			line, col = lineCol(b, int64(i+1))
+		}
+		return &configError{line: line, col: col, msg: unknownField(m[1], names)}
+	}
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		line, col := lineCol(b, e.Offset)
+		return &configError{line: line, col: col, msg: e.Error()}
+	case *json.UnmarshalTypeError:
+		line, col := lineCol(b, e.Offset)
+		return &configError{line: line, col: col, msg: fmt.Sprintf("%s: expected %s, was %s", e.Field, typeName(e.Type), jsonValueName(e.Value))}
+	}
+	return err
+}
+
+// lineCol returns the line and column of the byte before offset.
+func lineCol(b []byte, offset int64) (line, col int) {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	before := b[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - bytes.LastIndexByte(before, '\n') - 1
+	if col < 1 {
+		col = 1
+	}
+	return line, col
+}
+
+// jsonValueNames are the names of the JSON values in type errors.
+var jsonValueNames = map[string]string{
+	"string": "a string",
+	"bool":   "a bool",
+	"number": "a number",
+	"array":  "a list",
+	"object": "a map",
+}
+
+func jsonValueName(v string) string {
+	if f := strings.Fields(v); len(f) > 0 && jsonValueNames[f[0]] != "" {
+		return jsonValueNames[f[0]]
+	}
+	return v
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// decodeYAML decodes a YAML config. The YAML parser reports the line but
+// not the column of syntax errors.
+func decodeYAML(b []byte, cfg *config) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return &configError{line: line, msg: m[2]}
+		}
+		return &configError{line: 1, msg: err.Error()}
+	}
+	n, err := yamlNode(&doc)
+	if err != nil {
+		return err
+	}
+	return decodeNode("", n, reflect.ValueOf(cfg).Elem())
+}
+
+func yamlNode(n *yaml.Node) (*node, error) {
+	out := &node{line: n.Line, col: n.Column}
+	switch n.Kind {
+	case 0:
+		// empty document
+		out.line, out.col, out.value = 1, 1, map[string]*node{}
+	case yaml.DocumentNode:
+		return yamlNode(n.Content[0])
+	case yaml.AliasNode:
+		return yamlNode(n.Alias)
+	case yaml.MappingNode:
+		m := map[string]*node{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := yamlNode(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[n.Content[i].Value] = v
+		}
+		out.value = m
+	case yaml.SequenceNode:
+		l := []*node{}
+		for _, c := range n.Content {
+			v, err := yamlNode(c)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		out.value = l
+	case yaml.ScalarNode:
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, &configError{line: n.Line, col: n.Column, msg: err.Error()}
+		}
+		if i, ok := v.(int); ok {
+			v = int64(i)
+		}
+		out.value, out.raw = v, n.Value
+	}
+	return out, nil
+}
+
+var tomlErrorPosition = regexp.MustCompile(`^\((\d+), (\d+)\): (.*)$`)
+
+func decodeTOML(b []byte, cfg *config) error {
+	tree, err := toml.LoadBytes(b)
+	if err != nil {
+		if m := tomlErrorPosition.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			col, _ := strconv.Atoi(m[2])
+			return &configError{line: line, col: col, msg: m[3]}
+		}
+		return &configError{line: 1, msg: err.Error()}
+	}
+	return decodeNode("", tomlNode(tree), reflect.ValueOf(cfg).Elem())
+}
+
+func tomlNode(t *toml.Tree) *node {
+	m := map[string]*node{}
+	for _, k := range t.Keys() {
+		path := []string{k}
+		m[k] = tomlValue(t.GetPath(path), t.GetPositionPath(path))
+	}
+	pos := t.Position()
+	return &node{line: pos.Line, col: pos.Col, value: m}
+}
+
+func tomlValue(v interface{}, pos toml.Position) *node {
+	switch v := v.(type) {
+	case *toml.Tree:
+		return tomlNode(v)
+	case []*toml.Tree:
+		l := []*node{}
+		for _, t := range v {
+			l = append(l, tomlNode(t))
+		}
+		return &node{line: pos.Line, col: pos.Col, value: l}
+	case []interface{}:
+		l := []*node{}
+		for _, e := range v {
+			l = append(l, tomlValue(e, pos))
+		}
+		return &node{line: pos.Line, col: pos.Col, value: l}
+	}
+	return &node{line: pos.Line, col: pos.Col, value: v}
+}
+
+// node is a value of a YAML or TOML config with its position. value is nil,
+// a string, bool, int64, float64, []*node or map[string]*node. raw is the
+// scalar as written in YAML configs and shared credentials files.
+type node struct {
+	line, col int
+	value     interface{}
+	raw       string
+}
+
+func (n *node) errorf(name, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if name != "" {
+		msg = name + ": " + msg
+	}
+	return &configError{line: n.line, col: n.col, msg: msg}
+}
+
+// decodeNode decodes n into v, mapping keys to struct fields by their json
+// tags. name is the key of n in messages.
+func decodeNode(name string, n *node, v reflect.Value) error {
+	if n.value == nil {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		switch x := n.value.(type) {
+		case string:
+			v.SetString(x)
+		case int64:
+			// e.g. unquoted serials and account ids, keeping leading zeros
+			if n.raw != "" {
+				v.SetString(n.raw)
+			} else {
+				v.SetString(strconv.FormatInt(x, 10))
+			}
+		default:
+			return n.errorf(name, "expected a string, was %s", valueName(n.value))
+		}
+	case reflect.Bool:
+		x, ok := n.value.(bool)
+		if !ok {
+			return n.errorf(name, "expected a bool, was %s", valueName(n.value))
+		}
+		v.SetBool(x)
+	case reflect.Int:
+		x, ok := n.value.(int64)
+		if !ok {
+			return n.errorf(name, "expected an integer, was %s", valueName(n.value))
+		}
+		v.SetInt(x)
+	case reflect.Slice:
+		l, ok := n.value.([]*node)
+		if !ok {
+			return n.errorf(name, "expected a list, was %s", valueName(n.value))
+		}
+		s := reflect.MakeSlice(v.Type(), len(l), len(l))
+		for i, e := range l {
+			if err := decodeNode(fmt.Sprintf("%s[%d]", name, i), e, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Map:
+		m, ok := n.value.(map[string]*node)
+		if !ok {
+			return n.errorf(name, "expected a map, was %s", valueName(n.value))
+		}
+		out := reflect.MakeMap(v.Type())
+		for k, e := range m {
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeNode(name+"."+k, e, ev); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k), ev)
+		}
+		v.Set(out)
+	case reflect.Struct:
+		m, ok := n.value.(map[string]*node)
+		if !ok {
+			return n.errorf(name, "expected a map, was %s", valueName(n.value))
+		}
+		fields := map[string]int{}
+		for i := 0; i < v.NumField(); i++ {
+			fields[jsonName(v.Type().Field(i))] = i
+		}
+		keys := []string{}
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			key := k
+			if name != "" {
+				key = name + "." + k
+			}
+			i, ok := fields[k]
+			if !ok {
+				return m[k].errorf("", "%s", unknownField(key, fieldNames(v.Type())))
+			}
+			if err := decodeNode(key, m[k], v.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return n.errorf(name, "unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func jsonName(f reflect.StructField) string {
+	tag := strings.Split(f.Tag.Get("json"), ",")[0]
+	if tag == "" {
+		return f.Name
+	}
+	return tag
+}
+
+func valueName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "a string"
+	case bool:
+		return "a bool"
+	case int64:
+		return "an integer"
+	case float64:
+		return "a number"
+	case []*node:
+		return "a list"
+	case map[string]*node:
+		return "a map"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a bool"
+	case reflect.Int:
+		return "an integer"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "a map"
+	}
+	return t.String()
+}
@@ -0,0 +1,114 @@
+package awscfg
+
+import (
+	"reflect"
+	"testing"
+)
+
+const jsonConfig = `{
+	"aws_access_key_id": "key",
+	"aws_secret_access_key": "secret",
+	"aws_yubikey_serial": "1234567",
+	"aws_mfa_attempts": 5,
+	"aws_auto_clamp": true,
+	"tags": {"user": "alice"},
+	"role_chain": [{"role_arn": "arn:aws:iam::111111111111:role/hub", "mfa": true}]
+}`
+
+const yamlConfig = `# the key of alice
+aws_access_key_id: key
+aws_secret_access_key: secret
+aws_yubikey_serial: 1234567
+aws_mfa_attempts: 5
+aws_auto_clamp: true
+tags:
+  user: alice
+role_chain:
+  - role_arn: arn:aws:iam::111111111111:role/hub
+    mfa: true
+`
+
+const tomlConfig = `# the key of alice
+aws_access_key_id = "key"
+aws_secret_access_key = "secret"
+aws_yubikey_serial = "1234567"
+aws_mfa_attempts = 5
+aws_auto_clamp = true
+
+[tags]
+user = "alice"
+
+[[role_chain]]
+role_arn = "arn:aws:iam::111111111111:role/hub"
+mfa = true
+`
+
+func TestDecodeConfig(t *testing.T) {
+	want := &config{
+		AWSAccessKeyID:     "key",
+		AWSSecretAccessKey: "secret",
+		AWSYubikeySerial:   "1234567",
+		AWSMFAAttempts:     5,
+		AWSAutoClamp:       true,
+		Tags:               map[string]string{"user": "alice"},
+		RoleChain:          []roleHop{{RoleARN: "arn:aws:iam::111111111111:role/hub", MFA: true}},
+	}
+	tests := []struct {
+		Path    string
+		Content string
+	}{
+		{"aws.json", jsonConfig},
+		{"aws.yaml", yamlConfig},
+		{"aws.yml", yamlConfig},
+		{"aws.toml", tomlConfig},
+		{"aws.conf", jsonConfig},
+		{"aws.conf", yamlConfig},
+		{"aws.conf", tomlConfig},
+	}
+	for i, tc := range tests {
+		cfg := &config{}
+		if err := decodeConfig(tc.Path, []byte(tc.Content), cfg); err != nil {
+			t.Errorf("%d: %s", i+1, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%d: want=%#v has=%#v", i+1, want, cfg)
+		}
+	}
+}
+
+func TestDecodeYAMLNumbers(t *testing.T) {
+	cfg := &config{}
+	if err := decodeConfig("aws.yaml", []byte("sso_account_id: 012345670123\naws_yubikey_serial: 0x10\n"), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SSOAccountID != "012345670123" || cfg.AWSYubikeySerial != "0x10" {
+		t.Errorf("expected numbers as written, was %q and %q", cfg.SSOAccountID, cfg.AWSYubikeySerial)
+	}
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	tests := []struct {
+		Path    string
+		Content string
+		Want    string
+	}{
+		{"aws.json", "{\n\t\"aws_mfa_attempts\": \"5\"\n}", "aws.json:2:24: aws_mfa_attempts: expected an integer, was a string"},
+		{"aws.json", "{\n\t\"aws_access_key_id\": \"key\" // comment\n}", "aws.json:2:29: invalid character '/' after object key:value pair"},
+		{"aws.yaml", "aws_access_key_id: key\naws_mfa_attempts: five\n", "aws.yaml:2:19: aws_mfa_attempts: expected an integer, was a string"},
+		{"aws.yaml", "role_chain:\n  - role_arn: [a]\n", "aws.yaml:2:15: role_chain[0].role_arn: expected a string, was a list"},
+		{"aws.yaml", "tags: [\n", "aws.yaml:1: did not find expected node content"},
+		{"aws.toml", "aws_access_key_id = \"key\"\naws_auto_clamp = 1\n", "aws.toml:2:1: aws_auto_clamp: expected a bool, was an integer"},
+		{"aws.toml", "aws_access_key_id = \n", "aws.toml:2:1: expecting a value"},
+		{"aws.json", "{\n\t\"aws_yubi_key\": \"me\"\n}", "aws.json:2:2: unknown field \"aws_yubi_key\", did you mean \"aws_yubikey\"?"},
+		{"aws.yaml", "aws_yubi_key: me\n", "aws.yaml:1:15: unknown field \"aws_yubi_key\", did you mean \"aws_yubikey\"?"},
+		{"aws.yaml", "role_chain:\n  - role_arn: a\n    durration: 1h\n", "aws.yaml:3:16: unknown field \"role_chain[0].durration\", did you mean \"duration\"?"},
+		{"aws.toml", "colour = \"red\"\n", "aws.toml:1:1: unknown field \"colour\""},
+	}
+	for i, tc := range tests {
+		err := decodeConfig(tc.Path, []byte(tc.Content), &config{})
+		if err == nil || len(err.Error()) < len(tc.Want) || err.Error()[:len(tc.Want)] != tc.Want {
+			t.Errorf("%d: expected error starting with %q, was %v", i+1, tc.Want, err)
+		}
+	}
+}
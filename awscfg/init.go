@@ -0,0 +1,245 @@
+package awscfg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/phrase/aws-mfa/yubiauth"
+)
+
+// DefaultConfigPath returns the path new configs are written to,
+// $XDG_CONFIG_HOME/aws-mfa/config.yaml.
+func DefaultConfigPath() string {
+	home, _ := os.UserHomeDir()
+	return strings.Replace(configPatterns(home)[0], "config.*", "config.yaml", 1)
+}
+
+// Init asks for the access key, region, account name and yubikey account of
+// a new config, verifies the access key and writes the config to path,
+// readable only by the user. Instructions on how to use it are printed to w.
+func Init(path string, w io.Writer) error {
+	p := newTerminalPrompter(os.Stdin, os.Stderr)
+	return runInit(context.Background(), p, w, path, &config{}, yubikeyAccounts)
+}
+
+// runInit runs Init with the prompter p. cfg has the settings not asked for,
+// accounts returns the accounts of the connected yubikeys.
+func runInit(ctx context.Context, p prompter, w io.Writer, path string, cfg *config, accounts func() []string) error {
+	if configFormat(path, nil) == formatShared {
+		return fmt.Errorf("%s is the shared credentials file of the aws command line tool, use the path of an aws-mfa config", path)
+	}
+	if trimEncryptedExt(path) != path {
+		return fmt.Errorf("init writes unencrypted configs, encrypt %s afterwards and change it with aws-mfa config edit", filepath.Base(trimEncryptedExt(path)))
+	}
+	if other := otherConfig(path); other != "" {
+		return fmt.Errorf("%s exists and would no longer be found, change it with aws-mfa config edit or remove it first", other)
+	}
+	if fileExists(path) {
+		answer, err := p.prompt(ctx, path+" exists, overwrite it? [y/N]", false)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(strings.ToLower(answer), "y") {
+			return errors.New("config not written")
+		}
+	}
+
+	var err error
+	ask := func(msg, def string, check func(string) error) string {
+		if def != "" {
+			msg += " [" + def + "]"
+		}
+		for err == nil {
+			var v string
+			if v, err = p.prompt(ctx, msg, false); err != nil {
+				return ""
+			}
+			if v == "" {
+				v = def
+			}
+			cerr := check(v)
+			if cerr == nil {
+				return v
+			}
+			fmt.Fprintln(os.Stderr, cerr)
+		}
+		return ""
+	}
+	cfg.AWSAccessKeyID = ask("Access key ID", "", func(v string) error {
+		if !strings.HasPrefix(v, "AKIA") {
+			return errors.New("expected the ID of the access key of an IAM user, starting with AKIA")
+		}
+		return nil
+	})
+	if err == nil {
+		cfg.AWSSecretAccessKey, err = p.prompt(ctx, "Secret access key", true)
+	}
+	cfg.AWSDefaultRegion = ask("Region", "us-east-1", func(v string) error {
+		return checkRegion("region", v)
+	})
+	cfg.AWSAccountName = ask("Account name (optional, e.g. the alias of the account)", "", func(string) error { return nil })
+	if err != nil {
+		return err
+	}
+
+	if names := accounts(); len(names) > 0 {
+		fmt.Fprintln(os.Stderr, "OATH accounts of the connected yubikeys:")
+		for i, n := range names {
+			fmt.Fprintf(os.Stderr, "%d) %s\n", i+1, n)
+		}
+		cfg.AWSYubikey = ask("Yubikey account for the MFA codes (number or name, empty for none)", "", func(string) error { return nil })
+		if i, ierr := strconv.Atoi(cfg.AWSYubikey); ierr == nil && i >= 1 && i <= len(names) {
+			cfg.AWSYubikey = names[i-1]
+		}
+	} else {
+		cfg.AWSYubikey = ask("Yubikey account for the MFA codes (optional)", "", func(string) error { return nil })
+	}
+	if err != nil {
+		return err
+	}
+	if cfg.AWSSecretAccessKey == "" {
+		return errors.New("the secret access key is required")
+	}
+
+	if err := verifyAccessKey(cfg); err != nil {
+		return err
+	}
+	if err := writeNewConfig(path, cfg); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s\n", path)
+	printUsage(w, path, cfg)
+	return nil
+}
+
+// otherConfig returns a config other than path found by the same pattern of
+// configPatterns, e.g. config.toml for config.yaml. Configs are only found
+// if the pattern matches one file.
+func otherConfig(path string) string {
+	home, _ := os.UserHomeDir()
+	abs, _ := filepath.Abs(path)
+	for _, pattern := range configPatterns(home) {
+		if ok, _ := filepath.Match(pattern, abs); !ok {
+			continue
+		}
+		matches, _ := filepath.Glob(pattern)
+		for _, m := range matches {
+			if m != abs {
+				return m
+			}
+		}
+	}
+	return ""
+}
+
+// yubikeyAccounts returns the OATH accounts of all connected yubikeys.
+func yubikeyAccounts() []string {
+	devices, err := yubiauth.Devices(yubiOptions(context.Background(), &config{}, newTerminalPrompter(os.Stdin, os.Stderr)))
+	if err != nil {
+		dbg.Printf("listing yubikey accounts: %s", err)
+		return nil
+	}
+	names := []string{}
+	for _, d := range devices {
+		names = append(names, d.Accounts...)
+	}
+	return names
+}
+
+// verifyAccessKey checks that the access key of cfg is valid and that its
+// IAM user has an MFA device.
+func verifyAccessKey(cfg *config) error {
+	i := iam.New(session.New(iamConfig(cfg, staticCredentials(cfg))))
+	user, err := i.GetUser(nil)
+	if err != nil {
+		return explainError(cfg, "iam:GetUser", err)
+	}
+	fmt.Fprintf(os.Stderr, "access key of %s\n", *user.User.Arn)
+	res, err := i.ListMFADevices(nil)
+	if err != nil {
+		return explainError(cfg, "iam:ListMFADevices", err)
+	}
+	if len(res.MFADevices) != 1 {
+		return fmt.Errorf("expected 1 mfa device of %s, was %d", *user.User.Arn, len(res.MFADevices))
+	}
+	fmt.Fprintf(os.Stderr, "mfa device %s\n", *res.MFADevices[0].SerialNumber)
+	return nil
+}
+
+// writeNewConfig writes the string settings of cfg to path in the format of
+// its extension, readable only by the user.
+func writeNewConfig(path string, cfg *config) error {
+	v := reflect.ValueOf(cfg).Elem()
+	lines := []string{}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() != reflect.String || f.String() == "" {
+			continue
+		}
+		name := jsonName(v.Type().Field(i))
+		value, _ := json.Marshal(f.String())
+		switch configFormat(path, nil) {
+		case formatJSON:
+			lines = append(lines, fmt.Sprintf("\t%q: %s", name, value))
+		case formatTOML:
+			lines = append(lines, fmt.Sprintf("%s = %s", name, value))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+	content := strings.Join(lines, "\n") + "\n"
+	if configFormat(path, nil) == formatJSON {
+		content = "{\n" + strings.Join(lines, ",\n") + "\n}\n"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// the mode of existing files is not changed by OpenFile
+	return os.Chmod(path, 0600)
+}
+
+// printUsage prints how to use the config at path: nothing is needed for
+// the default config, others are used with an alias. The profile snippet
+// uses aws-mfa with the aws command line tool and SDKs.
+func printUsage(w io.Writer, path string, cfg *config) {
+	name := cfg.AWSAccountName
+	if name == "" {
+		name = "mfa"
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, name)
+	if path == DefaultConfigPath() {
+		fmt.Fprintln(w, "# aws-mfa uses this config by default, e.g.")
+		fmt.Fprintln(w, "aws-mfa sts get-caller-identity")
+	} else {
+		fmt.Fprintln(w, "# add to your shell config:")
+		fmt.Fprintf(w, "alias aws-%s='AWS_CREDENTIALS_PATH=%s aws-mfa'\n", name, path)
+	}
+	fmt.Fprintln(w, "\n# or add to ~/.aws/config to use it with the aws command line tool and SDKs:")
+	fmt.Fprintf(w, "[profile %s]\ncredential_process = aws-mfa --config %s credential-process\n", name, path)
+}
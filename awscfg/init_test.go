@@ -0,0 +1,108 @@
+package awscfg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// scriptedPrompter answers prompts in order.
+type scriptedPrompter struct {
+	answers []string
+	prompts []string
+}
+
+func (p *scriptedPrompter) prompt(ctx context.Context, msg string, secret bool) (string, error) {
+	p.prompts = append(p.prompts, msg)
+	if len(p.answers) == 0 {
+		return "", fmt.Errorf("unexpected prompt %q", msg)
+	}
+	a := p.answers[0]
+	p.answers = p.answers[1:]
+	return a, nil
+}
+
+func (p *scriptedPrompter) notify(ctx context.Context, msg string) {
+}
+
+func TestInit(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	srv := newTestSTS(t)
+	defer srv.Close()
+	accounts := func() []string { return []string{"AWS:phrase", "GitHub"} }
+
+	path := filepath.Join(dir, "aws-mfa", "config.toml")
+	p := &scriptedPrompter{answers: []string{"key", "AKIAEXAMPLE", "secret", "eu-wst-1", "", "phrase", "1"}}
+	out := &bytes.Buffer{}
+	if err := runInit(context.Background(), p, out, path, &config{AWSIAMEndpoint: srv.URL}, accounts); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "aws_access_key_id = \"AKIAEXAMPLE\"\naws_secret_access_key = \"secret\"\naws_default_region = \"us-east-1\"\naws_account_name = \"phrase\"\naws_yubikey = \"AWS:phrase\"\naws_iam_endpoint = \"" + srv.URL + "\"\n"
+	if string(b) != want {
+		t.Errorf("want=%q has=%q", want, b)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, was %v", fi.Mode())
+	}
+	if len(p.prompts) != 7 || p.prompts[3] != "Region [us-east-1]" {
+		t.Errorf("unexpected prompts %q", p.prompts)
+	}
+	if !strings.Contains(out.String(), "alias aws-phrase='AWS_CREDENTIALS_PATH="+path+" aws-mfa'") {
+		t.Errorf("expected alias, was %q", out)
+	}
+	cfg, err := readConfigFromFile(path)
+	if err != nil || cfg.AWSYubikey != "AWS:phrase" {
+		t.Errorf("expected config to be readable, was %#v %v", cfg, err)
+	}
+
+	// existing configs are only overwritten after confirming
+	p = &scriptedPrompter{answers: []string{"n"}}
+	if err := runInit(context.Background(), p, out, path, &config{AWSIAMEndpoint: srv.URL}, accounts); err == nil || err.Error() != "config not written" {
+		t.Errorf("expected error, was %v", err)
+	}
+
+	// the config is not written without an MFA device
+	srv.devices = 0
+	path = filepath.Join(dir, "config.json")
+	p = &scriptedPrompter{answers: []string{"AKIAEXAMPLE", "secret", "", "", ""}}
+	if err := runInit(context.Background(), p, out, path, &config{AWSIAMEndpoint: srv.URL}, func() []string { return nil }); err == nil || err.Error() != "expected 1 mfa device of arn:aws:iam::123456789012:user/me, was 0" {
+		t.Errorf("expected error, was %v", err)
+	}
+	if fileExists(path) {
+		t.Error("expected config not to be written")
+	}
+}
+
+func TestInitExistingConfigs(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer setenv(t, map[string]string{"XDG_CONFIG_HOME": dir})()
+	writeFiles(t, dir, map[string]string{"aws-mfa/config.toml.gpg": "encrypted"})
+
+	tests := []struct {
+		Path string
+		Want string
+	}{
+		{filepath.Join(dir, "aws-mfa", "config.yaml"), filepath.Join(dir, "aws-mfa", "config.toml.gpg") + " exists and would no longer be found"},
+		{filepath.Join(dir, "aws-mfa", "config.toml.gpg"), "init writes unencrypted configs, encrypt config.toml afterwards"},
+		{filepath.Join(dir, "aws.yaml.asc"), "init writes unencrypted configs"},
+	}
+	for i, tc := range tests {
+		p := &scriptedPrompter{}
+		err := runInit(context.Background(), p, &bytes.Buffer{}, tc.Path, &config{}, func() []string { return nil })
+		if err == nil || !strings.HasPrefix(err.Error(), tc.Want) {
+			t.Errorf("%d: expected error starting with %q, was %v", i+1, tc.Want, err)
+		}
+	}
+}
@@ -6,7 +6,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/phrase/awscfg/metadata"
+	"github.com/phrase/aws-mfa/awscfg/metadata"
 )
 
 func NewFromMetadata() (*aws.Config, error) {
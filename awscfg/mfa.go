@@ -0,0 +1,59 @@
+package awscfg
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// defaultMFAAttempts is the number of MFA codes asked for before giving up.
+const defaultMFAAttempts = 3
+
+// maxClockSkew is the difference between the local and the AWS clock after
+// which codes generated locally are likely rejected.
+const maxClockSkew = totpStep
+
+// isMFAError returns true when err was returned by STS because it did not
+// accept the MFA code.
+func isMFAError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "AccessDenied" && strings.Contains(aerr.Message(), "MultiFactorAuthentication")
+}
+
+// mfaErrorReason explains why code was rejected. generated is true for codes
+// read from a yubikey, skew is the difference between the AWS clock and the
+// local one.
+func mfaErrorReason(code string, generated bool, last *usedCode, now time.Time, skew time.Duration) string {
+	switch {
+	case skew > maxClockSkew || skew < -maxClockSkew:
+		return fmt.Sprintf("your clock is off by %s, please sync it (e.g. using ntp)", skew.Round(time.Second))
+	case last.check(code, now) != nil:
+		return "the code was already used, please wait for the next one"
+	case generated:
+		// codes read from a yubikey can not be mistyped
+		return "the code was already used (e.g. by another session), please wait for the next one"
+	default:
+		return "the code was wrong"
+	}
+}
+
+// clockSkew records the difference between the Date header of AWS responses
+// and the local clock.
+type clockSkew struct {
+	skew time.Duration
+}
+
+func (c *clockSkew) handler(r *request.Request) {
+	if r.HTTPResponse == nil {
+		return
+	}
+	t, err := http.ParseTime(r.HTTPResponse.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	c.skew = t.Sub(time.Now())
+}
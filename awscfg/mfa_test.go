@@ -0,0 +1,119 @@
+package awscfg
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestIsMFAError(t *testing.T) {
+	tests := []struct {
+		Err  error
+		Want bool
+	}{
+		{awserr.New("AccessDenied", "MultiFactorAuthentication failed with invalid MFA one time pass code.", nil), true},
+		{awserr.New("AccessDenied", "User is not authorized to perform: sts:GetSessionToken", nil), false},
+		{awserr.New("InvalidClientTokenId", "The security token included in the request is invalid.", nil), false},
+		{errors.New("MultiFactorAuthentication"), false},
+	}
+	for i, tc := range tests {
+		if has := isMFAError(tc.Err); has != tc.Want {
+			t.Errorf("%d: want=%t has=%t", i+1, tc.Want, has)
+		}
+	}
+}
+
+func TestMFAErrorReason(t *testing.T) {
+	now := time.Now()
+	last := &usedCode{Code: "123456", Time: now.Add(-5 * time.Second)}
+	tests := []struct {
+		Code      string
+		Generated bool
+		Skew      time.Duration
+		Want      string
+	}{
+		{"234567", false, 0, "the code was wrong"},
+		{"234567", true, 0, "the code was already used (e.g. by another session), please wait for the next one"},
+		{"123456", false, 0, "the code was already used, please wait for the next one"},
+		{"234567", false, -2 * time.Minute, "your clock is off by -2m0s, please sync it (e.g. using ntp)"},
+	}
+	for i, tc := range tests {
+		if has := mfaErrorReason(tc.Code, tc.Generated, last, now, tc.Skew); has != tc.Want {
+			t.Errorf("%d: want=%q has=%q", i+1, tc.Want, has)
+		}
+	}
+}
+
+func TestWithMFA(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	srv := newTestSTS(t)
+	defer srv.Close()
+	srv.reject["111111"], srv.reject["444444"] = true, true
+
+	cfg := &config{
+		AWSAccessKeyID:     "AKIAEXAMPLE",
+		AWSSecretAccessKey: "secret",
+		AWSDefaultRegion:   "eu-west-1",
+		AWSSTSEndpoint:     srv.URL,
+		AWSIAMEndpoint:     srv.URL,
+		AWSPrompt:          "sh",
+	}
+	cachePath := filepath.Join(dir, "AKIAEXAMPLE.json")
+	assume := func(codes ...string) (*sts.Credentials, error) {
+		defer promptCodes(codes...)()
+		stsClient := sts.New(session.New(stsConfig(cfg, staticCredentials(cfg))))
+		return withMFA(cfg, "sts:AssumeRole", cachePath, stsClient, func(serial, token *string) (*sts.Credentials, error) {
+			res, err := stsClient.AssumeRole(&sts.AssumeRoleInput{
+				RoleArn:         aws.String("arn:aws:iam::123456789012:role/admin"),
+				RoleSessionName: aws.String("test"),
+				SerialNumber:    serial,
+				TokenCode:       token,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return res.Credentials, nil
+		})
+	}
+
+	// rejected codes are asked for again
+	if _, err := assume("111111", "222222"); err != nil {
+		t.Fatal(err)
+	}
+	// the used code is not sent again
+	if _, err := assume("222222", "333333"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ListMFADevices AKIAEXAMPLE",
+		"AssumeRole AKIAEXAMPLE admin 111111",
+		"AssumeRole AKIAEXAMPLE admin 222222",
+		"ListMFADevices AKIAEXAMPLE",
+		"AssumeRole AKIAEXAMPLE admin 333333",
+	}
+	if strings.Join(srv.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want=%q has=%q", want, srv.requests)
+	}
+	if u := readUsedCode(usedCodePath(cachePath, "arn:aws:iam::123456789012:mfa/me")); u == nil || u.Code != "333333" {
+		t.Errorf("expected used code to be stored, was %#v", u)
+	}
+
+	// codes are asked for aws_mfa_attempts times
+	srv.requests = nil
+	cfg.AWSMFAAttempts = 2
+	_, err := assume("111111", "444444", "555555")
+	if err == nil || err.Error() != "mfa code not accepted after 2 attempts: the code was wrong" {
+		t.Errorf("expected error after 2 attempts, was %v", err)
+	}
+	if len(srv.requests) != 3 {
+		t.Errorf("expected 2 codes to be sent, was %q", srv.requests)
+	}
+}
@@ -0,0 +1,73 @@
+package awscfg
+
+// Options override the configuration read from the credentials file, e.g.
+// with command line flags. Empty fields are ignored.
+type Options struct {
+	RoleARN         string
+	RoleSessionName string
+	// Tags are merged into the tags of the configuration.
+	Tags map[string]string
+	// TransitiveTagKeys are added to the keys of the configuration.
+	TransitiveTagKeys []string
+	SourceIdentity    string
+	// Policy is either an inline JSON policy or the path of a file with one.
+	Policy string
+	// PolicyARNs are added to the policy ARNs of the configuration.
+	PolicyARNs []string
+	// AutoClamp uses the closest allowed duration instead of failing for
+	// durations out of the range STS accepts.
+	AutoClamp bool
+}
+
+// apply overrides the settings of cfg with o, recording the flags as their
+// sources.
+func (o *Options) apply(cfg *config, sources map[string]string) {
+	if o == nil {
+		return
+	}
+	set := func(name, flag string) {
+		if old := sources[name]; old != "" && (name == "tags" || name == "transitive_tag_keys" || name == "policy_arns") {
+			// lists and tags are merged
+			sources[name] = flag + ", " + old
+			return
+		}
+		sources[name] = flag
+	}
+	if o.RoleARN != "" {
+		cfg.RoleARN = o.RoleARN
+		set("role_arn", "flag --role-arn")
+	}
+	if o.RoleSessionName != "" {
+		cfg.RoleSessionName = o.RoleSessionName
+		set("role_session_name", "flag --role-session-name")
+	}
+	if len(o.Tags) > 0 {
+		if cfg.Tags == nil {
+			cfg.Tags = map[string]string{}
+		}
+		for k, v := range o.Tags {
+			cfg.Tags[k] = v
+		}
+		set("tags", "flag --tag")
+	}
+	if len(o.TransitiveTagKeys) > 0 {
+		cfg.TransitiveTagKeys = append(cfg.TransitiveTagKeys, o.TransitiveTagKeys...)
+		set("transitive_tag_keys", "flag --transitive-tag-key")
+	}
+	if o.SourceIdentity != "" {
+		cfg.SourceIdentity = o.SourceIdentity
+		set("source_identity", "flag --source-identity")
+	}
+	if o.Policy != "" {
+		cfg.Policy = o.Policy
+		set("policy", "flag --policy")
+	}
+	if len(o.PolicyARNs) > 0 {
+		cfg.PolicyARNs = append(cfg.PolicyARNs, o.PolicyARNs...)
+		set("policy_arns", "flag --policy-arn")
+	}
+	if o.AutoClamp {
+		cfg.AWSAutoClamp = true
+		set("aws_auto_clamp", "flag --auto-clamp")
+	}
+}
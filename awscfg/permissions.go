@@ -0,0 +1,106 @@
+package awscfg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// permissionProblems returns why the file at path is not private: it can be
+// read or written by other users or it is in a directory other users can
+// write to, so they could replace it.
+func permissionProblems(path string) ([]string, error) {
+	if !checkFileModes {
+		return nil, nil
+	}
+	problems := []string{}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if m := fi.Mode().Perm(); m&0077 != 0 {
+		problems = append(problems, fmt.Sprintf("%s can be accessed by other users (mode %04o), run chmod 600 %s", path, m, path))
+	}
+	if !ownedByUser(fi) {
+		problems = append(problems, fmt.Sprintf("%s is owned by another user", path))
+	}
+	dir := filepath.Dir(path)
+	di, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	// other users can't replace files in directories with the sticky bit
+	// like /tmp
+	if m := di.Mode(); m.Perm()&0022 != 0 && m&os.ModeSticky == 0 {
+		problems = append(problems, fmt.Sprintf("%s can be written by other users (mode %04o), run chmod go-w %s", dir, m.Perm(), dir))
+	}
+	if !ownedByUser(di) && di.Mode()&os.ModeSticky == 0 {
+		problems = append(problems, fmt.Sprintf("%s is owned by another user", dir))
+	}
+	return problems, nil
+}
+
+// checkPermissions returns an error if the file at path is not private. With
+// lenient, the problems are only printed as warnings.
+func checkPermissions(path string, lenient bool) error {
+	problems, err := permissionProblems(path)
+	if err != nil || len(problems) == 0 {
+		return err
+	}
+	if lenient {
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, "warning: "+p)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s (set aws_lenient_permissions or AWS_MFA_LENIENT_PERMISSIONS=true to only warn)", strings.Join(problems, ", "))
+}
+
+// privateCache returns true if the cache file at path does not exist or is
+// private. Cached secrets other users could have read or replaced are not
+// used unless aws_lenient_permissions is set.
+func privateCache(cfg *config, path string) bool {
+	if !fileExists(path) {
+		return true
+	}
+	if err := checkPermissions(path, cfg.AWSLenientPermissions); err != nil {
+		fmt.Fprintf(os.Stderr, "ignoring cached credentials: %s\n", err)
+		return false
+	}
+	return true
+}
+
+// CheckPermissions prints the permission problems of the config at path and
+// of the cached sessions to w and returns an error if there are any.
+func CheckPermissions(w io.Writer, path string) error {
+	if !checkFileModes {
+		return errors.New("permissions are not checked on this platform")
+	}
+	paths := []string{path}
+	cached, _ := filepath.Glob(filepath.Join(cacheDir, "*.json"))
+	sort.Strings(cached)
+	paths = append(paths, cached...)
+	problems := 0
+	for _, p := range paths {
+		found, err := permissionProblems(p)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			fmt.Fprintf(w, "%s: ok\n", p)
+			continue
+		}
+		for _, f := range found {
+			fmt.Fprintln(w, f)
+		}
+		problems += len(found)
+	}
+	if problems > 0 {
+		return fmt.Errorf("found %d permission problems", problems)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package awscfg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestPermissionProblems(t *testing.T) {
+	if !checkFileModes {
+		t.Skip("file modes are not checked on this platform")
+	}
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	writeFiles(t, dir, map[string]string{"private/config.yaml": "", "shared/config.yaml": "", "sticky/config.yaml": ""})
+	os.Chmod(filepath.Join(dir, "shared"), 0777)
+	os.Chmod(filepath.Join(dir, "sticky"), 0777|os.ModeSticky)
+	os.Chmod(filepath.Join(dir, "sticky/config.yaml"), 0644)
+
+	tests := []struct {
+		Path string
+		Want []string
+	}{
+		{"private/config.yaml", []string{}},
+		{"shared/config.yaml", []string{"{dir}/shared can be written by other users (mode 0777), run chmod go-w {dir}/shared"}},
+		{"sticky/config.yaml", []string{"{dir}/sticky/config.yaml can be accessed by other users (mode 0644), run chmod 600 {dir}/sticky/config.yaml"}},
+	}
+	for i, tc := range tests {
+		has, err := permissionProblems(filepath.Join(dir, tc.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{}
+		for _, w := range tc.Want {
+			want = append(want, strings.Replace(w, "{dir}", dir, -1))
+		}
+		if strings.Join(has, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%d: want=%#v has=%#v", i+1, want, has)
+		}
+	}
+
+	path := filepath.Join(dir, "sticky/config.yaml")
+	if err := checkPermissions(path, false); err == nil || !strings.Contains(err.Error(), "AWS_MFA_LENIENT_PERMISSIONS") {
+		t.Errorf("expected error, was %v", err)
+	}
+	if err := checkPermissions(path, true); err != nil {
+		t.Errorf("expected just a warning, was %v", err)
+	}
+	if _, _, err := resolveConfig(path, nil); err == nil || !strings.HasPrefix(err.Error(), path+" can be accessed by other users") {
+		t.Errorf("expected config to be refused, was %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	defer func(dir string) { cacheDir = dir }(cacheDir)
+	cacheDir = filepath.Join(dir, "cache")
+	if err := CheckPermissions(buf, path); err == nil || err.Error() != "found 1 permission problems" {
+		t.Errorf("expected error, was %v", err)
+	}
+}
+
+func TestCachePermissions(t *testing.T) {
+	if !checkFileModes {
+		t.Skip("file modes are not checked on this platform")
+	}
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "cache", "AKIA.json")
+	writeFiles(t, dir, map[string]string{"cache/AKIA.json": ""})
+	os.Chmod(path, 0644)
+
+	exp := time.Now().Add(time.Hour)
+	creds := &sts.Credentials{AccessKeyId: aws.String("ASIA"), SecretAccessKey: aws.String("s"), SessionToken: aws.String("t"), Expiration: &exp}
+	if err := storeCredentials(path, creds); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, was %v %v", fi.Mode(), err)
+	}
+	if readCachedCredentials(&config{}, path) == nil {
+		t.Error("expected cached credentials")
+	}
+
+	os.Chmod(path, 0644)
+	if readCachedCredentials(&config{}, path) != nil {
+		t.Error("expected credentials readable by others to be ignored")
+	}
+	if readCachedCredentials(&config{AWSLenientPermissions: true}, path) == nil {
+		t.Error("expected cached credentials with aws_lenient_permissions")
+	}
+}
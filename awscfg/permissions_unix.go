@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package awscfg
+
+import (
+	"os"
+	"syscall"
+)
+
+const checkFileModes = true
+
+func ownedByUser(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return !ok || int(st.Uid) == os.Getuid()
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package awscfg
+
+import "os"
+
+// file modes do not reflect the ACLs of windows
+const checkFileModes = false
+
+func ownedByUser(fi os.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,181 @@
+package awscfg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// prompter asks the user for input, e.g. for MFA codes, and shows notices
+// like the one to insert the yubikey.
+type prompter interface {
+	// prompt asks for a single line of input. secret input is hidden if the
+	// frontend supports it.
+	prompt(ctx context.Context, msg string, secret bool) (string, error)
+	// notify shows msg until ctx is done without waiting for input.
+	notify(ctx context.Context, msg string)
+}
+
+// terminalPrompter prompts on stderr and reads from in. Secrets are read
+// without echo when in is a terminal.
+type terminalPrompter struct {
+	in      io.Reader
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func newTerminalPrompter(in io.Reader, out io.Writer) *terminalPrompter {
+	return &terminalPrompter{in: in, scanner: bufio.NewScanner(in), out: out}
+}
+
+func (t *terminalPrompter) prompt(ctx context.Context, msg string, secret bool) (string, error) {
+	fmt.Fprint(t.out, msg+": ")
+	if f, ok := t.in.(*os.File); ok && secret && term.IsTerminal(int(f.Fd())) {
+		b, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(t.out)
+		return strings.TrimSpace(string(b)), err
+	}
+	if !t.scanner.Scan() {
+		if err := t.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.ErrUnexpectedEOF
+	}
+	return strings.TrimSpace(t.scanner.Text()), nil
+}
+
+func (t *terminalPrompter) notify(ctx context.Context, msg string) {
+	fmt.Fprintln(t.out, msg)
+}
+
+// commandPrompter prompts using a desktop tool like dmenu or zenity.
+type commandPrompter struct {
+	name       string
+	promptArgs func(msg string, secret bool) []string
+	noticeArgs func(msg string) []string
+	// x11 is true for tools not working with wayland.
+	x11 bool
+}
+
+// frontends are the supported desktop prompt tools in the order they are
+// detected in.
+var frontends = []*commandPrompter{
+	{
+		name: "zenity",
+		promptArgs: func(msg string, secret bool) []string {
+			if secret {
+				return []string{"--entry", "--hide-text", "--text", msg}
+			}
+			return []string{"--entry", "--text", msg}
+		},
+		noticeArgs: func(msg string) []string { return []string{"--info", "--text", msg} },
+	},
+	{
+		name: "kdialog",
+		promptArgs: func(msg string, secret bool) []string {
+			if secret {
+				return []string{"--password", msg}
+			}
+			return []string{"--inputbox", msg}
+		},
+		noticeArgs: func(msg string) []string { return []string{"--msgbox", msg} },
+	},
+	{
+		name: "rofi",
+		promptArgs: func(msg string, secret bool) []string {
+			if secret {
+				return []string{"-dmenu", "-password", "-p", msg}
+			}
+			return []string{"-dmenu", "-p", msg}
+		},
+		noticeArgs: func(msg string) []string { return []string{"-e", msg} },
+	},
+	{
+		name:       "dmenu",
+		promptArgs: func(msg string, secret bool) []string { return []string{"-p", msg} },
+		noticeArgs: func(msg string) []string { return []string{"-p", msg} },
+		x11:        true,
+	},
+}
+
+func (c *commandPrompter) prompt(ctx context.Context, msg string, secret bool) (string, error) {
+	cmd := exec.CommandContext(ctx, c.name, c.promptArgs(msg, secret)...)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	// dmenu and rofi read the entries to choose from from stdin
+	cmd.Stdin = strings.NewReader("")
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok && stderr.Len() == 0 {
+			return "", fmt.Errorf("%s prompt cancelled", c.name)
+		}
+		return "", fmt.Errorf("running %s: %s %s", c.name, err, stderr)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (c *commandPrompter) notify(ctx context.Context, msg string) {
+	cmd := exec.CommandContext(ctx, c.name, c.noticeArgs(msg)...)
+	if err := cmd.Start(); err != nil {
+		dbg.Printf("error showing notice with %s: %s", c.name, err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// findFrontend returns the desktop prompt tool called name or nil.
+func findFrontend(name string) *commandPrompter {
+	for _, f := range frontends {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// newPrompter returns the prompter configured as aws_prompt. Without one, the
+// terminal is used if stdin is one. Otherwise the first desktop tool found is
+// used when running in a graphical session.
+func newPrompter(cfg *config) prompter {
+	terminal := newTerminalPrompter(os.Stdin, os.Stderr)
+	if name := cfg.AWSPrompt; name != "" {
+		if name == "terminal" {
+			return terminal
+		}
+		if f := findFrontend(name); f != nil {
+			return f
+		}
+		log.Printf("unknown aws_prompt %q, using the terminal", name)
+		return terminal
+	}
+	if isTerminal(os.Stdin) {
+		return terminal
+	}
+	x11, wayland := os.Getenv("DISPLAY") != "", os.Getenv("WAYLAND_DISPLAY") != ""
+	for _, f := range frontends {
+		if (x11 || (wayland && !f.x11)) && hasCommand(f.name) {
+			dbg.Printf("prompting using %s", f.name)
+			return f
+		}
+	}
+	return terminal
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,56 @@
+package awscfg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadMFAToken(t *testing.T) {
+	last := &usedCode{Code: "123456", Time: time.Now()}
+	out := &bytes.Buffer{}
+	p := newTerminalPrompter(strings.NewReader("12345\n123456\n234567\n"), out)
+	code, err := readMFAToken(context.Background(), p, "phrase", func(code string) error {
+		return last.check(code, time.Now())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "234567" {
+		t.Errorf("expected code to be %q, was %q", "234567", code)
+	}
+	msg := "AWS MFA token for account phrase please: "
+	if v, ex := out.String(), msg+msg+errCodeUsed.Error()+". "+msg; v != ex {
+		t.Errorf("expected output to be %q, was %q", ex, v)
+	}
+
+	_, err = readMFAToken(context.Background(), newTerminalPrompter(strings.NewReader(""), out), "", func(string) error { return nil })
+	if err == nil {
+		t.Error("expected error when no code was entered")
+	}
+}
+
+func TestNewPrompter(t *testing.T) {
+	tests := []struct {
+		Prompt string
+		Want   string
+	}{
+		{"terminal", "*awscfg.terminalPrompter"},
+		{"unknown", "*awscfg.terminalPrompter"},
+		{"rofi", "rofi"},
+		{"kdialog", "kdialog"},
+	}
+	for _, tc := range tests {
+		p := newPrompter(&config{AWSPrompt: tc.Prompt})
+		has := fmt.Sprintf("%T", p)
+		if c, ok := p.(*commandPrompter); ok {
+			has = c.name
+		}
+		if has != tc.Want {
+			t.Errorf("%s: want=%s has=%s", tc.Prompt, tc.Want, has)
+		}
+	}
+}
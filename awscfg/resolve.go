@@ -0,0 +1,215 @@
+package awscfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Settings are resolved in this order, the first one set wins: command line
+// flags (Options), AWS_MFA_* environment variables, the profile of the shared
+// credentials file and the config file.
+
+const envPrefix = "AWS_MFA_"
+
+// envName returns the environment variable overriding the setting name,
+// e.g. AWS_MFA_DEFAULT_REGION for aws_default_region.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.TrimPrefix(name, "aws_"))
+}
+
+// resolveConfig reads the config at path and applies the environment
+// overrides and opts. The returned sources map the names of all settings set
+// to where their values are from.
+func resolveConfig(path string, opts *Options) (*config, map[string]string, error) {
+	cfg, sources, err := readConfigWithSources(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := applyEnv(cfg, sources); err != nil {
+		return nil, nil, err
+	}
+	if err := checkPermissions(path, cfg.AWSLenientPermissions); err != nil {
+		return nil, nil, err
+	}
+	opts.apply(cfg, sources)
+	return cfg, sources, nil
+}
+
+// readConfigWithSources reads the config at path and returns the sources of
+// its settings: the path, the profile of a shared credentials file or, for
+// the region of a profile, the shared config.
+func readConfigWithSources(path string) (*config, map[string]string, error) {
+	b, err := readConfigFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := &config{}
+	if err := decodeConfig(path, b, cfg); err != nil {
+		return nil, nil, err
+	}
+	var profile string
+	var section map[string]string
+	if configFormat(path, b) == formatShared {
+		creds, err := parseLocalConfig(bytes.NewReader(b))
+		if err != nil {
+			return nil, nil, err
+		}
+		profile = sharedProfile()
+		section = creds[profile]
+	}
+	sources := map[string]string{}
+	for _, name := range fieldNames(reflect.TypeOf(config{})) {
+		if !isSet(cfg, name) {
+			continue
+		}
+		switch _, ok := section[name]; {
+		case section == nil:
+			sources[name] = path
+		case ok:
+			sources[name] = fmt.Sprintf("profile %s of %s", profile, path)
+		default:
+			sources[name] = sharedConfigPath(path)
+		}
+	}
+	return cfg, sources, nil
+}
+
+// applyEnv sets the settings of cfg overridden with AWS_MFA_* environment
+// variables. Lists are separated by commas, tags are key=value pairs and
+// role_chain is a JSON list.
+func applyEnv(cfg *config, sources map[string]string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := jsonName(v.Type().Field(i))
+		env := envName(name)
+		s := os.Getenv(env)
+		if s == "" {
+			continue
+		}
+		if err := decodeEnv(s, v.Field(i)); err != nil {
+			return fmt.Errorf("%s: %s", env, err)
+		}
+		sources[name] = "env " + env
+	}
+	return nil
+}
+
+func decodeEnv(s string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expected a bool, was %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("expected an integer, was %q", s)
+		}
+		v.SetInt(int64(i))
+	case reflect.Map:
+		m := map[string]string{}
+		for _, kv := range splitList(s) {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return fmt.Errorf("%q must be key=value", kv)
+			}
+			m[parts[0]] = parts[1]
+		}
+		v.Set(reflect.ValueOf(m))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			v.Set(reflect.ValueOf(splitList(s)))
+			return nil
+		}
+		d := json.NewDecoder(strings.NewReader(s))
+		d.DisallowUnknownFields()
+		if err := d.Decode(v.Addr().Interface()); err != nil {
+			return fmt.Errorf("expected a JSON list: %s", err)
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// splitList splits the comma separated list s.
+func splitList(s string) []string {
+	l := []string{}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+// secretSettings are masked when showing a config.
+var secretSettings = map[string]bool{
+	"aws_secret_access_key": true,
+}
+
+// ShowConfig prints the settings of the config at path to w. With resolved,
+// the environment overrides and opts are applied and the source of every
+// value is printed. Secrets are masked.
+func ShowConfig(w io.Writer, path string, opts *Options, resolved bool) error {
+	var cfg *config
+	var sources map[string]string
+	var err error
+	if resolved {
+		cfg, sources, err = resolveConfig(path, opts)
+	} else {
+		cfg, sources, err = readConfigWithSources(path)
+	}
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := jsonName(v.Type().Field(i))
+		if !isSet(cfg, name) {
+			continue
+		}
+		value := showValue(v.Field(i))
+		if secretSettings[name] {
+			value = maskSecret(value)
+		}
+		if resolved {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", name, value, sources[name])
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\n", name, value)
+		}
+	}
+	return tw.Flush()
+}
+
+func showValue(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	b, _ := json.Marshal(v.Interface())
+	return string(b)
+}
+
+// maskSecret returns the last 4 characters of long secrets, like the aws
+// command line tool. References to secrets are not masked.
+func maskSecret(s string) string {
+	switch {
+	case strings.HasPrefix(s, "env:"), strings.HasPrefix(s, "file:"):
+		return s
+	case len(s) < 16:
+		return strings.Repeat("*", 16)
+	}
+	return strings.Repeat("*", 16) + s[len(s)-4:]
+}
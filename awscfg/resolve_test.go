@@ -0,0 +1,109 @@
+package awscfg
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct{ Has, Want string }{
+		{"aws_default_region", "AWS_MFA_DEFAULT_REGION"},
+		{"aws_mfa_attempts", "AWS_MFA_MFA_ATTEMPTS"},
+		{"role_arn", "AWS_MFA_ROLE_ARN"},
+		{"sso_start_url", "AWS_MFA_SSO_START_URL"},
+	}
+	for i, tc := range tests {
+		if has := envName(tc.Has); has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, has)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	defer setenv(t, map[string]string{
+		"AWS_MFA_DURATION":            "12h",
+		"AWS_MFA_AUTO_CLAMP":          "true",
+		"AWS_MFA_MFA_ATTEMPTS":        "5",
+		"AWS_MFA_TAGS":                "team=a, project=b",
+		"AWS_MFA_TRANSITIVE_TAG_KEYS": "team,project",
+		"AWS_MFA_ROLE_CHAIN":          `[{"role_arn": "123456789012:role/a", "mfa": true}]`,
+	})()
+	cfg := &config{AWSDuration: "1h", AWSDefaultRegion: "eu-west-1"}
+	sources := map[string]string{"aws_duration": "aws.yaml", "aws_default_region": "aws.yaml"}
+	if err := applyEnv(cfg, sources); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{cfg.AWSDuration, "12h"},
+		{cfg.AWSDefaultRegion, "eu-west-1"},
+		{cfg.AWSAutoClamp, true},
+		{cfg.AWSMFAAttempts, 5},
+		{cfg.Tags, map[string]string{"team": "a", "project": "b"}},
+		{cfg.TransitiveTagKeys, []string{"team", "project"}},
+		{cfg.RoleChain, []roleHop{{RoleARN: "123456789012:role/a", MFA: true}}},
+		{sources["aws_duration"], "env AWS_MFA_DURATION"},
+		{sources["aws_default_region"], "aws.yaml"},
+		{sources["role_chain"], "env AWS_MFA_ROLE_CHAIN"},
+	}
+	for i, tc := range tests {
+		if !reflect.DeepEqual(tc.Has, tc.Want) {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+
+	errs := []struct{ Env, Value, Want string }{
+		{"AWS_MFA_AUTO_CLAMP", "maybe", `AWS_MFA_AUTO_CLAMP: expected a bool, was "maybe"`},
+		{"AWS_MFA_MAX_RETRIES", "many", `AWS_MFA_MAX_RETRIES: expected an integer, was "many"`},
+		{"AWS_MFA_TAGS", "team", `AWS_MFA_TAGS: "team" must be key=value`},
+	}
+	for i, tc := range errs {
+		reset := setenv(t, map[string]string{tc.Env: tc.Value})
+		err := applyEnv(&config{}, map[string]string{})
+		reset()
+		if err == nil || err.Error() != tc.Want {
+			t.Errorf("%d: want=%q has=%v", i+1, tc.Want, err)
+		}
+	}
+}
+
+func TestResolveConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	writeFiles(t, dir, map[string]string{
+		".aws/credentials": "[work]\naws_access_key_id = AKIA\naws_secret_access_key = wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY\naws_duration = 1h\n",
+		".aws/config":      "[profile work]\nregion = eu-west-1\n",
+	})
+	defer setenv(t, map[string]string{"HOME": dir, "AWS_PROFILE": "work", "AWS_SHARED_CREDENTIALS_FILE": "", "AWS_CONFIG_FILE": "", "AWS_MFA_DURATION": "2h"})()
+	path := filepath.Join(dir, ".aws/credentials")
+	cfg, sources, err := resolveConfig(path, &Options{RoleARN: "123456789012:role/admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"aws_access_key_id":     "profile work of " + path,
+		"aws_secret_access_key": "profile work of " + path,
+		"aws_duration":          "env AWS_MFA_DURATION",
+		"aws_default_region":    filepath.Join(dir, ".aws/config"),
+		"role_arn":              "flag --role-arn",
+	}
+	if !reflect.DeepEqual(want, sources) {
+		t.Errorf("want=%#v has=%#v", want, sources)
+	}
+	if cfg.AWSDuration != "2h" || cfg.RoleARN != "123456789012:role/admin" {
+		t.Errorf("unexpected config %#v", cfg)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ShowConfig(buf, path, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	wantShow := "aws_access_key_id      AKIA\n" +
+		"aws_secret_access_key  ****************EKEY\n" +
+		"aws_default_region     eu-west-1\n" +
+		"aws_duration           1h\n"
+	if buf.String() != wantShow {
+		t.Errorf("want=%q has=%q", wantShow, buf.String())
+	}
+}
@@ -0,0 +1,296 @@
+package awscfg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const defaultRoleDuration = 1 * time.Hour
+
+// roleHop is a role assumed with the credentials of the previous hop of a
+// role chain. The MFA code is passed when assuming hops with MFA set.
+type roleHop struct {
+	RoleARN         string `json:"role_arn"`
+	RoleSessionName string `json:"role_session_name,omitempty"`
+	Duration        string `json:"duration,omitempty"`
+	MFA             bool   `json:"mfa,omitempty"`
+}
+
+// roleChain returns the roles to assume in order: the hops of role_chain
+// followed by role_arn.
+func (cfg *config) roleChain() []roleHop {
+	chain := append([]roleHop{}, cfg.RoleChain...)
+	if cfg.RoleARN != "" {
+		chain = append(chain, roleHop{RoleARN: cfg.RoleARN, RoleSessionName: cfg.RoleSessionName, Duration: cfg.RoleDuration})
+	}
+	return chain
+}
+
+// assumeRoleChain assumes the roles of chain one after the other. The first
+// hop is assumed with the base credentials or, if one of the hops requires
+// MFA, with the credentials of the IAM user. The credentials of
+// every hop are cached per access key and AssumeRole input of all hops up to
+// it, so changing e.g. a tag or the policy results in new sessions.
+func assumeRoleChain(cfg *config, chain []roleHop) (*sts.Credentials, error) {
+	ins, err := assumeRoleInputs(cfg, chain)
+	if err != nil {
+		return nil, err
+	}
+	name, err := cfg.cacheName()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(ins))
+	for i := range ins {
+		key, err := roleCacheKey(ins[:i+1])
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = filepath.Join(cacheDir, name+"-"+key+".json")
+	}
+
+	// continue after the last hop with valid cached credentials
+	var creds *credentials.Credentials
+	start := 0
+	for i := len(ins) - 1; i >= 0; i-- {
+		if c := readCachedCredentials(cfg, paths[i]); c != nil {
+			if i == len(ins)-1 {
+				return c, nil
+			}
+			creds, start = sessionCredentials(c), i+1
+			break
+		}
+	}
+	// MFA hops list the MFA device with the access key, also when resuming
+	if chainRequiresMFA(chain[start:]) {
+		if cfg.Type != "" && cfg.Type != typeIAMUser {
+			return nil, fmt.Errorf("mfa in role_chain requires an %s configuration", typeIAMUser)
+		}
+		if err := cfg.resolveAccessKey(); err != nil {
+			return nil, err
+		}
+	}
+	if creds == nil {
+		if chainRequiresMFA(chain) {
+			creds = staticCredentials(cfg)
+		} else {
+			c, err := baseCredentials(cfg)
+			if err != nil {
+				return nil, err
+			}
+			creds = sessionCredentials(c)
+		}
+	}
+
+	var c *sts.Credentials
+	for i := start; i < len(ins); i++ {
+		in := ins[i]
+		if err := checkMaxRoleDuration(cfg, creds, in); err != nil {
+			return nil, err
+		}
+		stsClient := sts.New(session.New(stsConfig(cfg, creds)))
+		assume := func(serial, token *string) (*sts.Credentials, error) {
+			in.SerialNumber, in.TokenCode = serial, token
+			res, err := stsClient.AssumeRole(in)
+			if err != nil {
+				return nil, err
+			}
+			return res.Credentials, nil
+		}
+		if chain[i].MFA {
+			c, err = withMFA(cfg, "sts:AssumeRole", paths[i], stsClient, assume)
+		} else if c, err = assume(nil, nil); err != nil {
+			err = explainError(cfg, "sts:AssumeRole", err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("assuming role %s: %s", *in.RoleArn, err)
+		}
+		if err := storeCredentials(paths[i], c); err != nil {
+			log.Printf("error storing credentials: %s", err)
+		}
+		creds = sessionCredentials(c)
+	}
+	return c, nil
+}
+
+// checkMaxRoleDuration checks the duration of in against the maximum session
+// duration of the role, if it is longer than the one every role allows and
+// the role can be read with creds.
+func checkMaxRoleDuration(cfg *config, creds *credentials.Credentials, in *sts.AssumeRoleInput) error {
+	dur := time.Duration(*in.DurationSeconds) * time.Second
+	if dur <= defaultRoleDuration {
+		return nil
+	}
+	max, ok := maxRoleDuration(iamConfig(cfg, creds), *in.RoleArn)
+	if !ok {
+		return nil
+	}
+	limits := durationLimits{"sessions of role " + *in.RoleArn, roleLimits.min, max}
+	dur, err := limits.check("duration", dur, cfg.AWSAutoClamp)
+	if err != nil {
+		return err
+	}
+	in.DurationSeconds = aws.Int64(int64(dur.Seconds()))
+	return nil
+}
+
+func chainRequiresMFA(chain []roleHop) bool {
+	for _, h := range chain {
+		if h.MFA {
+			return true
+		}
+	}
+	return false
+}
+
+// chainedHop returns true if hop i of the role chain is assumed with the
+// credentials of another role: all hops but the first and, as sso and
+// web_identity credentials are role sessions, the first one of these.
+func (cfg *config) chainedHop(i int) bool {
+	return i > 0 || cfg.Type == typeSSO || cfg.Type == typeWebIdentity
+}
+
+func sessionCredentials(c *sts.Credentials) *credentials.Credentials {
+	return credentials.NewStaticCredentials(*c.AccessKeyId, *c.SecretAccessKey, *c.SessionToken)
+}
+
+// assumeRoleInputs returns the AssumeRole inputs of all hops of chain. Tags
+// and the source identity are set on the first hop (transitive tags are
+// passed on to the following ones), session policies on the last one.
+func assumeRoleInputs(cfg *config, chain []roleHop) ([]*sts.AssumeRoleInput, error) {
+	ins := []*sts.AssumeRoleInput{}
+	for i, h := range chain {
+		in, err := assumeRoleInput(cfg, h, cfg.chainedHop(i))
+		if err != nil {
+			return nil, err
+		}
+		ins = append(ins, in)
+	}
+	if len(ins) == 0 {
+		return ins, nil
+	}
+	first, last := ins[0], ins[len(ins)-1]
+	if cfg.SourceIdentity != "" {
+		first.SourceIdentity = aws.String(cfg.SourceIdentity)
+	}
+	keys := make([]string, 0, len(cfg.Tags))
+	for k := range cfg.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		first.Tags = append(first.Tags, &sts.Tag{Key: aws.String(k), Value: aws.String(cfg.Tags[k])})
+	}
+	for _, k := range cfg.TransitiveTagKeys {
+		if _, ok := cfg.Tags[k]; !ok {
+			return nil, fmt.Errorf("transitive tag key %q is not a tag", k)
+		}
+		first.TransitiveTagKeys = append(first.TransitiveTagKeys, aws.String(k))
+	}
+	if cfg.Policy != "" {
+		policy, err := readPolicy(cfg.Policy)
+		if err != nil {
+			return nil, err
+		}
+		last.Policy = aws.String(policy)
+	}
+	for _, arn := range cfg.PolicyARNs {
+		last.PolicyArns = append(last.PolicyArns, &sts.PolicyDescriptorType{Arn: aws.String(arn)})
+	}
+	return ins, nil
+}
+
+// assumeRoleInput returns the input of hop h. chained is true for hops
+// assumed with the credentials of another role, which AWS limits to one
+// hour.
+func assumeRoleInput(cfg *config, h roleHop, chained bool) (*sts.AssumeRoleInput, error) {
+	if h.RoleARN == "" {
+		return nil, fmt.Errorf("role_chain: role_arn missing")
+	}
+	arn, err := roleARN(cfg, h.RoleARN)
+	if err != nil {
+		return nil, err
+	}
+	dur := defaultRoleDuration
+	if h.Duration != "" {
+		if dur, err = parseDuration(h.Duration); err != nil {
+			return nil, fmt.Errorf("duration of role %s: %s", h.RoleARN, err)
+		}
+	}
+	limits := roleLimits
+	if chained {
+		limits = chainedRoleLimits
+	}
+	dur, err = limits.check("duration of role "+h.RoleARN, dur, cfg.AWSAutoClamp)
+	if err != nil {
+		return nil, err
+	}
+	name := h.RoleSessionName
+	if name == "" {
+		name = cfg.RoleSessionName
+	}
+	if name == "" {
+		name = defaultSessionName()
+	}
+	return &sts.AssumeRoleInput{
+		RoleArn:         aws.String(arn),
+		RoleSessionName: aws.String(name),
+		DurationSeconds: aws.Int64(int64(dur.Seconds())),
+	}, nil
+}
+
+// readPolicy returns policy if it is an inline JSON document. Otherwise the
+// policy is read from the file at path policy.
+func readPolicy(policy string) (string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(policy), "{") {
+		b, err := ioutil.ReadFile(policy)
+		if err != nil {
+			return "", fmt.Errorf("reading policy: %s", err)
+		}
+		policy = string(b)
+	}
+	if !json.Valid([]byte(policy)) {
+		return "", fmt.Errorf("policy is not valid JSON")
+	}
+	return policy, nil
+}
+
+// roleCacheKey returns a hash of everything in the AssumeRole inputs of a
+// role chain which influences the resulting session.
+func roleCacheKey(ins []*sts.AssumeRoleInput) (string, error) {
+	b, err := json.Marshal(ins)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+var invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// defaultSessionName is aws-mfa- followed by the name of the current user.
+func defaultSessionName() string {
+	name := "aws-mfa"
+	if u, err := user.Current(); err == nil {
+		name += "-" + invalidSessionNameChars.ReplaceAllString(u.Username, "_")
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,357 @@
+package awscfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssumeRoleInput(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	policyPath := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(policyPath, []byte(`{"Version": "2012-10-17"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config{
+		RoleARN:           "arn:aws:iam::123456789012:role/admin",
+		RoleSessionName:   "alice",
+		Tags:              map[string]string{"user": "alice", "ticket": "OPS-1"},
+		TransitiveTagKeys: []string{"user"},
+		SourceIdentity:    "alice",
+		Policy:            policyPath,
+		PolicyARNs:        []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+	}
+	ins, err := assumeRoleInputs(cfg, cfg.roleChain())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := ins[0]
+	tests := []struct{ Has, Want interface{} }{
+		{*in.RoleSessionName, "alice"},
+		{*in.DurationSeconds, int64(3600)},
+		{len(in.Tags), 2},
+		{*in.Tags[0].Key, "ticket"},
+		{*in.TransitiveTagKeys[0], "user"},
+		{*in.SourceIdentity, "alice"},
+		{*in.Policy, `{"Version": "2012-10-17"}`},
+		{*in.PolicyArns[0].Arn, "arn:aws:iam::aws:policy/ReadOnlyAccess"},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+
+	cfg.TransitiveTagKeys = []string{"missing"}
+	if _, err := assumeRoleInputs(cfg, cfg.roleChain()); err == nil {
+		t.Error("expected error for transitive tag key without tag")
+	}
+	cfg.TransitiveTagKeys = nil
+	cfg.Policy = `{"Version": `
+	if _, err := assumeRoleInputs(cfg, cfg.roleChain()); err == nil {
+		t.Error("expected error for invalid inline policy")
+	}
+}
+
+func TestRoleCacheKey(t *testing.T) {
+	base := func() *config {
+		return &config{RoleARN: "arn:aws:iam::123456789012:role/admin", RoleSessionName: "alice", Tags: map[string]string{"a": "1", "b": "2"}}
+	}
+	key := func(cfg *config) string {
+		ins, err := assumeRoleInputs(cfg, cfg.roleChain())
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := roleCacheKey(ins)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	k := key(base())
+	if k2 := key(base()); k2 != k {
+		t.Errorf("expected key to be stable, was %q and %q", k, k2)
+	}
+	changes := []func(*config){
+		func(c *config) { c.Tags["b"] = "3" },
+		func(c *config) { c.SourceIdentity = "alice" },
+		func(c *config) { c.Policy = `{}` },
+		func(c *config) { c.PolicyARNs = []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"} },
+		func(c *config) { c.TransitiveTagKeys = []string{"a"} },
+		func(c *config) { c.RoleSessionName = "bob" },
+	}
+	for i, change := range changes {
+		cfg := base()
+		change(cfg)
+		if key(cfg) == k {
+			t.Errorf("%d: expected key to change", i+1)
+		}
+	}
+}
+
+func TestRoleChainInputs(t *testing.T) {
+	cfg := &config{
+		RoleChain: []roleHop{
+			{RoleARN: "arn:aws:iam::111111111111:role/hub", Duration: "2h", MFA: true},
+			{RoleARN: "arn:aws:iam::222222222222:role/prod-admin"},
+		},
+		RoleARN:    "arn:aws:iam::333333333333:role/readonly",
+		Tags:       map[string]string{"user": "alice"},
+		PolicyARNs: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+	}
+	chain := cfg.roleChain()
+	ins, err := assumeRoleInputs(cfg, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{len(ins), 3},
+		{chainRequiresMFA(chain), true},
+		{*ins[0].DurationSeconds, int64(7200)},
+		{*ins[1].DurationSeconds, int64(3600)},
+		{*ins[2].RoleArn, "arn:aws:iam::333333333333:role/readonly"},
+		{len(ins[0].Tags), 1},
+		{len(ins[2].Tags), 0},
+		{len(ins[0].PolicyArns), 0},
+		{len(ins[2].PolicyArns), 1},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+
+	k1, _ := roleCacheKey(ins[:1])
+	k2, _ := roleCacheKey(ins[:2])
+	if k1 == k2 {
+		t.Error("expected every hop to be cached under its own key")
+	}
+
+	cfg.RoleChain[1].Duration = "2h"
+	if _, err := assumeRoleInputs(cfg, cfg.roleChain()); err == nil || !strings.Contains(err.Error(), "role chaining") {
+		t.Errorf("expected role chaining duration error, was %v", err)
+	}
+
+	// the first hop chains the role session of sso configs
+	sso := &config{Type: typeSSO, RoleARN: "arn:aws:iam::333333333333:role/readonly", RoleDuration: "2h"}
+	if _, err := assumeRoleInputs(sso, sso.roleChain()); err == nil || !strings.Contains(err.Error(), "role chaining") {
+		t.Errorf("expected role chaining duration error of sso config, was %v", err)
+	}
+}
+
+var credentialScope = regexp.MustCompile(`Credential=([^/]+)/`)
+
+// testSTS stands in for STS, IAM and the console federation endpoint. It
+// records requests as "<action> <access key or console session, - if
+// unsigned> <role or federated user> <mfa code>" and their forms, and returns
+// credentials named after the role, which expire after expiry[role] or an
+// hour. MFA codes in reject are not accepted. The first throttle requests are
+// throttled. The user has devices MFA devices.
+type testSTS struct {
+	*httptest.Server
+	requests []string
+	forms    []url.Values
+	expiry   map[string]time.Duration
+	reject   map[string]bool
+	throttle int
+	devices  int
+}
+
+func newTestSTS(t *testing.T) *testSTS {
+	s := &testSTS{expiry: map[string]time.Duration{}, reject: map[string]bool{}, devices: 1}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		key := "-"
+		if m := credentialScope.FindStringSubmatch(r.Header.Get("Authorization")); m != nil {
+			key = m[1]
+		}
+		action, role, code := r.Form.Get("Action"), "", r.Form.Get("TokenCode")
+		if action == "getSigninToken" {
+			var session map[string]string
+			if err := json.Unmarshal([]byte(r.Form.Get("Session")), &session); err != nil {
+				t.Error(err)
+			}
+			key = session["sessionId"]
+		}
+		if arn := r.Form.Get("RoleArn"); arn != "" {
+			role = path.Base(arn)
+		} else {
+			role = r.Form.Get("Name")
+		}
+		s.requests = append(s.requests, strings.TrimSpace(strings.Join([]string{action, key, role, code}, " ")))
+		s.forms = append(s.forms, r.Form)
+		if s.throttle > 0 {
+			s.throttle--
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>Throttling</Code><Message>Rate exceeded</Message></Error></ErrorResponse>`)
+			return
+		}
+		switch action {
+		case "GetUser":
+			fmt.Fprint(w, `<GetUserResponse><GetUserResult><User><UserName>me</UserName><Arn>arn:aws:iam::123456789012:user/me</Arn></User></GetUserResult></GetUserResponse>`)
+		case "ListMFADevices":
+			fmt.Fprint(w, `<ListMFADevicesResponse><ListMFADevicesResult><MFADevices>`)
+			for i := 0; i < s.devices; i++ {
+				fmt.Fprint(w, `<member><UserName>me</UserName><SerialNumber>arn:aws:iam::123456789012:mfa/me</SerialNumber></member>`)
+			}
+			fmt.Fprint(w, `</MFADevices></ListMFADevicesResult></ListMFADevicesResponse>`)
+		case "AssumeRole", "AssumeRoleWithWebIdentity":
+			if s.reject[code] {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>MultiFactorAuthentication failed with invalid MFA one time pass code.</Message></Error></ErrorResponse>`)
+				return
+			}
+			expiry := s.expiry[role]
+			if expiry == 0 {
+				expiry = time.Hour
+			}
+			fmt.Fprintf(w, `<%[1]sResponse><%[1]sResult><Credentials>
+				<AccessKeyId>ASIA-%s</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>
+				<SessionToken>token</SessionToken><Expiration>%s</Expiration>
+				</Credentials></%[1]sResult></%[1]sResponse>`, action, role, time.Now().Add(expiry).UTC().Format(time.RFC3339))
+		case "GetFederationToken":
+			fmt.Fprint(w, `<GetFederationTokenResponse><GetFederationTokenResult><Credentials>
+				<AccessKeyId>ASIAFEDERATED</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>
+				<SessionToken>token</SessionToken><Expiration>2030-01-01T00:00:00Z</Expiration>
+				</Credentials></GetFederationTokenResult></GetFederationTokenResponse>`)
+		case "getSigninToken":
+			fmt.Fprint(w, `{"SigninToken": "signin-token"}`)
+		default:
+			t.Errorf("unexpected action %s", action)
+		}
+	}))
+	return s
+}
+
+// promptCodes answers the prompts of aws_prompt "sh" with codes in order
+// and returns a func restoring the frontends.
+func promptCodes(codes ...string) func() {
+	old := frontends
+	frontends = append([]*commandPrompter{{
+		name: "sh",
+		promptArgs: func(msg string, secret bool) []string {
+			if len(codes) == 0 {
+				return []string{"-c", "exit 1"}
+			}
+			code := codes[0]
+			codes = codes[1:]
+			return []string{"-c", "echo " + code}
+		},
+		noticeArgs: func(msg string) []string { return []string{"-c", "true"} },
+	}}, old...)
+	return func() { frontends = old }
+}
+
+func TestAssumeRoleChainResumeMFA(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer func(dir string) { cacheDir = dir }(cacheDir)
+	cacheDir = dir
+	defer setenv(t, map[string]string{"TEST_AWS_KEY": "AKIAEXAMPLE"})()
+	defer promptCodes("123456", "234567")()
+
+	srv := newTestSTS(t)
+	defer srv.Close()
+	// the admin session expires too soon to be reused
+	srv.expiry["admin"] = 30 * time.Second
+	newConfig := func() *config {
+		return &config{
+			AWSAccessKeyID:     "env:TEST_AWS_KEY",
+			AWSSecretAccessKey: "secret",
+			AWSDefaultRegion:   "eu-west-1",
+			AWSSTSEndpoint:     srv.URL,
+			AWSIAMEndpoint:     srv.URL,
+			AWSPrompt:          "sh",
+			RoleChain:          []roleHop{{RoleARN: "arn:aws:iam::111111111111:role/hub"}, {RoleARN: "arn:aws:iam::222222222222:role/admin", MFA: true}},
+		}
+	}
+	for i := 0; i < 2; i++ {
+		cfg := newConfig()
+		c, err := assumeRoleChain(cfg, cfg.roleChain())
+		if err != nil {
+			t.Fatalf("%d: %s", i+1, err)
+		}
+		if *c.AccessKeyId != "ASIA-admin" {
+			t.Errorf("%d: unexpected credentials %v", i+1, c)
+		}
+	}
+	want := []string{
+		"AssumeRole AKIAEXAMPLE hub",
+		"ListMFADevices AKIAEXAMPLE",
+		"AssumeRole ASIA-hub admin 123456",
+		// resumed with the cached hub session
+		"ListMFADevices AKIAEXAMPLE",
+		"AssumeRole ASIA-hub admin 234567",
+	}
+	if strings.Join(srv.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want=%q has=%q", want, srv.requests)
+	}
+}
+
+func TestAssumeRoleChain(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer func(dir string) { cacheDir = dir }(cacheDir)
+	cacheDir = dir
+	defer promptCodes("123456")()
+
+	srv := newTestSTS(t)
+	defer srv.Close()
+	// the readonly session expires too soon to be reused
+	srv.expiry["readonly"] = 30 * time.Second
+	cfg := &config{
+		AWSAccessKeyID:     "AKIAEXAMPLE",
+		AWSSecretAccessKey: "secret",
+		AWSDefaultRegion:   "eu-west-1",
+		AWSSTSEndpoint:     srv.URL,
+		AWSIAMEndpoint:     srv.URL,
+		AWSPrompt:          "sh",
+		RoleChain:          []roleHop{{RoleARN: "arn:aws:iam::111111111111:role/hub"}, {RoleARN: "arn:aws:iam::222222222222:role/prod", MFA: true}},
+		RoleARN:            "arn:aws:iam::333333333333:role/readonly",
+	}
+	for i := 0; i < 2; i++ {
+		c, err := assumeRoleChain(cfg, cfg.roleChain())
+		if err != nil {
+			t.Fatalf("%d: %s", i+1, err)
+		}
+		if *c.AccessKeyId != "ASIA-readonly" {
+			t.Errorf("%d: unexpected credentials %v", i+1, c)
+		}
+	}
+	want := []string{
+		// the first hop is assumed with the access key as the chain requires MFA
+		"AssumeRole AKIAEXAMPLE hub",
+		"ListMFADevices AKIAEXAMPLE",
+		"AssumeRole ASIA-hub prod 123456",
+		"AssumeRole ASIA-prod readonly",
+		// resumed with the cached prod session without asking for a code
+		"AssumeRole ASIA-prod readonly",
+	}
+	if strings.Join(srv.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want=%q has=%q", want, srv.requests)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "AKIAEXAMPLE-*.json"))
+	if len(files) != 3 {
+		t.Errorf("expected every hop to be cached, was %q", files)
+	}
+
+	// changing a hop results in new sessions from it on
+	srv.requests = nil
+	cfg.Tags = map[string]string{"user": "alice"}
+	if _, err := assumeRoleChain(cfg, cfg.roleChain()); err == nil || !strings.Contains(err.Error(), "prompt cancelled") {
+		t.Errorf("expected to be asked for another code, was %v", err)
+	}
+	if len(srv.requests) != 2 || srv.requests[0] != "AssumeRole AKIAEXAMPLE hub" {
+		t.Errorf("expected chain to be assumed from the first hop, was %q", srv.requests)
+	}
+}
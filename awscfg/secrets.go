@@ -0,0 +1,94 @@
+package awscfg
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// resolveSecret returns the value of a setting which can be a reference:
+// env:VAR is the value of the environment variable VAR and file:path the
+// trimmed content of the file at path. Other values are returned as they are.
+func resolveSecret(setting, v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, "env:"):
+		name := strings.TrimPrefix(v, "env:")
+		s := os.Getenv(name)
+		if s == "" {
+			return "", fmt.Errorf("%s: environment variable %s is not set", setting, name)
+		}
+		return s, nil
+	case strings.HasPrefix(v, "file:"):
+		path := strings.TrimPrefix(v, "file:")
+		if strings.HasPrefix(path, "~/") {
+			home, _ := os.UserHomeDir()
+			path = home + path[1:]
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", setting, err)
+		}
+		s := strings.TrimSpace(string(b))
+		if s == "" {
+			return "", fmt.Errorf("%s: %s is empty", setting, path)
+		}
+		return s, nil
+	}
+	return v, nil
+}
+
+// checkReference returns an error if v is a reference without a name.
+func checkReference(setting, v string) error {
+	if v == "env:" || v == "file:" {
+		return fmt.Errorf("%s: %q is missing a name", setting, v)
+	}
+	return nil
+}
+
+// cacheName returns the name role sessions are cached with, identifying the
+// base credentials: the access key ID of an IAM user or, when
+// aws_access_key_id_command is used, a hash of the command so it is only run
+// when a new session is needed. sso and web_identity configs are identified
+// by a hash of their account and role and of their role and token source.
+func (cfg *config) cacheName() (string, error) {
+	switch {
+	case cfg.Type == typeSSO:
+		return hashedName("sso", cfg.SSOStartURL, cfg.SSOAccountID, cfg.SSORoleName), nil
+	case cfg.Type == typeWebIdentity:
+		return hashedName("web-identity", cfg.WebIdentityRoleARN, cfg.WebIdentityTokenFile, cfg.WebIdentityTokenCommand), nil
+	case cfg.AWSAccessKeyIDCommand != "":
+		return hashedName("command", cfg.AWSAccessKeyIDCommand), nil
+	}
+	return resolveSecret("aws_access_key_id", cfg.AWSAccessKeyID)
+}
+
+func hashedName(prefix string, parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return fmt.Sprintf("%s-%x", prefix, sum[:8])
+}
+
+// resolveAccessKey replaces the access key of the IAM user by the output of
+// aws_access_key_id_command and aws_secret_access_key_command or the values
+// of env: and file: references. It is called just before the access key is
+// used, so password managers are not asked while cached sessions are valid.
+func (cfg *config) resolveAccessKey() (err error) {
+	ctx := context.Background()
+	if cfg.AWSAccessKeyIDCommand != "" {
+		if cfg.AWSAccessKeyID, err = runSecretCommand(ctx, cfg.AWSAccessKeyIDCommand); err != nil {
+			return fmt.Errorf("aws_access_key_id_command: %s", err)
+		}
+	} else if cfg.AWSAccessKeyID, err = resolveSecret("aws_access_key_id", cfg.AWSAccessKeyID); err != nil {
+		return err
+	}
+	if cfg.AWSSecretAccessKeyCommand != "" {
+		if cfg.AWSSecretAccessKey, err = runSecretCommand(ctx, cfg.AWSSecretAccessKeyCommand); err != nil {
+			return fmt.Errorf("aws_secret_access_key_command: %s", err)
+		}
+	} else if cfg.AWSSecretAccessKey, err = resolveSecret("aws_secret_access_key", cfg.AWSSecretAccessKey); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package awscfg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer setenv(t, map[string]string{"AWS_MFA_TEST_SECRET": "from env"})()
+	writeFiles(t, dir, map[string]string{"secret": "from file\n", "empty": ""})
+
+	tests := []struct {
+		Has, Want string
+	}{
+		{"secret", "secret"},
+		{"env:AWS_MFA_TEST_SECRET", "from env"},
+		{"file:" + filepath.Join(dir, "secret"), "from file"},
+		{"env:AWS_MFA_TEST_MISSING", "error: aws_secret_access_key: environment variable AWS_MFA_TEST_MISSING is not set"},
+		{"file:" + filepath.Join(dir, "empty"), "error: aws_secret_access_key: " + filepath.Join(dir, "empty") + " is empty"},
+	}
+	for i, tc := range tests {
+		has, err := resolveSecret("aws_secret_access_key", tc.Has)
+		if err != nil {
+			has = "error: " + err.Error()
+		}
+		if has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, has)
+		}
+	}
+}
+
+func TestResolveAccessKey(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer func(dir string) { cacheDir = dir }(cacheDir)
+	cacheDir = dir
+
+	// the commands are not run while the cached session is valid
+	ran := filepath.Join(dir, "ran")
+	cfg := &config{
+		AWSAccessKeyIDCommand:     "touch " + ran + " && echo AKIA",
+		AWSSecretAccessKeyCommand: "echo secret",
+	}
+	name, err := cfg.cacheName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour)
+	cached := &sts.Credentials{AccessKeyId: aws.String("ASIA"), SecretAccessKey: aws.String("s"), SessionToken: aws.String("t"), Expiration: &exp}
+	if err := storeCredentials(filepath.Join(dir, name+".json"), cached); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := getSTSCredentials(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *creds.AccessKeyId != "ASIA" {
+		t.Errorf("expected cached credentials, were %v", creds)
+	}
+	if _, err := os.Stat(ran); !os.IsNotExist(err) {
+		t.Errorf("expected aws_access_key_id_command not to run, stat returned %v", err)
+	}
+
+	if err := cfg.resolveAccessKey(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWSAccessKeyID != "AKIA" || cfg.AWSSecretAccessKey != "secret" {
+		t.Errorf("unexpected access key %q %q", cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey)
+	}
+	if has, _ := cfg.cacheName(); has != name {
+		t.Errorf("expected cache name %q not to change, was %q", name, has)
+	}
+
+	cfg = &config{AWSAccessKeyID: "AKIA", AWSSecretAccessKeyCommand: "exit 1"}
+	if err := cfg.resolveAccessKey(); err == nil {
+		t.Error("expected error of failing command")
+	}
+}
+
+func TestCacheName(t *testing.T) {
+	sso := config{Type: typeSSO, SSOStartURL: "https://example.awsapps.com/start", SSOAccountID: "123456789012", SSORoleName: "admin"}
+	other := sso
+	other.SSOAccountID = "210987654321"
+	web := config{Type: typeWebIdentity, WebIdentityRoleARN: "arn:aws:iam::123456789012:role/ci", WebIdentityTokenFile: "token"}
+	names := map[string]bool{}
+	for i, cfg := range []config{{AWSAccessKeyID: "AKIA"}, {AWSAccessKeyIDCommand: "pass aws"}, sso, other, web} {
+		name, err := cfg.cacheName()
+		if err != nil || name == "" || names[name] {
+			t.Errorf("%d: expected a unique cache name, was %q %v", i+1, name, err)
+		}
+		names[name] = true
+	}
+}
@@ -0,0 +1,206 @@
+package awscfg
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sso"
+	"github.com/aws/aws-sdk-go/service/sso/ssoiface"
+	"github.com/aws/aws-sdk-go/service/ssooidc"
+	"github.com/aws/aws-sdk-go/service/ssooidc/ssooidciface"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	ssoClientName      = "aws-mfa"
+	ssoDeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// ssoSlowDown is added to the polling interval when asked to slow down.
+	ssoSlowDown = 5 * time.Second
+)
+
+// ssoToken is the registered OIDC client and the access token of an IAM
+// Identity Center login, cached per start URL.
+type ssoToken struct {
+	ClientID        string    `json:"client_id"`
+	ClientSecret    string    `json:"client_secret"`
+	ClientExpiresAt time.Time `json:"client_expires_at"`
+	AccessToken     string    `json:"access_token,omitempty"`
+	ExpiresAt       time.Time `json:"expires_at,omitempty"`
+}
+
+func (t *ssoToken) clientValid(now time.Time) bool {
+	return t != nil && t.ClientID != "" && t.ClientExpiresAt.After(now.Add(time.Hour))
+}
+
+func (t *ssoToken) tokenValid(now time.Time) bool {
+	return t.clientValid(now) && t.AccessToken != "" && t.ExpiresAt.After(now.Add(time.Minute))
+}
+
+// getSSOCredentials returns the credentials of sso_role_name in
+// sso_account_id. Without a valid cached access token the user is logged in
+// using the device authorization flow.
+func getSSOCredentials(cfg *config) (*sts.Credentials, error) {
+	if cfg.SSOStartURL == "" || cfg.SSOAccountID == "" || cfg.SSORoleName == "" {
+		return nil, fmt.Errorf("sso profiles require sso_start_url, sso_account_id and sso_role_name")
+	}
+	key := sha1.Sum([]byte(cfg.SSOStartURL))
+	prefix := filepath.Join(cacheDir, "sso-"+hex.EncodeToString(key[:8]))
+	cachePath := prefix + "-" + cfg.SSOAccountID + "-" + cfg.SSORoleName + ".json"
+	if creds := readCachedCredentials(cfg, cachePath); creds != nil {
+		return creds, nil
+	}
+
+	awsCfg := clientConfig(cfg, credentials.AnonymousCredentials).WithRegion(cfg.ssoRegion())
+	tokenPath := prefix + ".json"
+	token := readSSOToken(cfg, tokenPath)
+	if !token.tokenValid(time.Now()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var err error
+		if token, err = ssoLogin(ctx, ssooidc.New(session.New(awsCfg)), cfg, token, newPrompter(cfg)); err != nil {
+			return nil, err
+		}
+		cancel()
+		if err := storeCredentials(tokenPath, token); err != nil {
+			log.Printf("error storing sso token: %s", err)
+		}
+	}
+	creds, err := ssoRoleCredentials(sso.New(session.New(awsCfg)), cfg, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := storeCredentials(cachePath, creds); err != nil {
+		log.Printf("error storing credentials: %s", err)
+	}
+	return creds, nil
+}
+
+func (cfg *config) ssoRegion() string {
+	if cfg.SSORegion != "" {
+		return cfg.SSORegion
+	}
+	return cfg.AWSDefaultRegion
+}
+
+func readSSOToken(cfg *config, path string) *ssoToken {
+	if !privateCache(cfg, path) {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var t *ssoToken
+	if err := json.NewDecoder(f).Decode(&t); err != nil {
+		dbg.Printf("error reading sso token from %s: %s", path, err)
+		return nil
+	}
+	return t
+}
+
+// ssoLogin registers a client unless token has a valid one and then logs in
+// using the device authorization flow: the user confirms the login in the
+// browser while the token is polled for.
+func ssoLogin(ctx context.Context, api ssooidciface.SSOOIDCAPI, cfg *config, token *ssoToken, p prompter) (*ssoToken, error) {
+	if !token.clientValid(time.Now()) {
+		res, err := api.RegisterClient(&ssooidc.RegisterClientInput{
+			ClientName: aws.String(ssoClientName),
+			ClientType: aws.String("public"),
+		})
+		if err != nil {
+			return nil, explainError(cfg, "sso-oidc:RegisterClient", err)
+		}
+		token = &ssoToken{
+			ClientID:        aws.StringValue(res.ClientId),
+			ClientSecret:    aws.StringValue(res.ClientSecret),
+			ClientExpiresAt: time.Unix(aws.Int64Value(res.ClientSecretExpiresAt), 0),
+		}
+	}
+	auth, err := api.StartDeviceAuthorization(&ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     aws.String(token.ClientID),
+		ClientSecret: aws.String(token.ClientSecret),
+		StartUrl:     aws.String(cfg.SSOStartURL),
+	})
+	if err != nil {
+		return nil, explainError(cfg, "sso-oidc:StartDeviceAuthorization", err)
+	}
+	p.notify(ctx, fmt.Sprintf("open %s and confirm the code %s to log in", aws.StringValue(auth.VerificationUriComplete), aws.StringValue(auth.UserCode)))
+
+	interval := 5 * time.Second
+	if auth.Interval != nil {
+		interval = time.Duration(*auth.Interval) * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(aws.Int64Value(auth.ExpiresIn)) * time.Second)
+	for {
+		res, err := api.CreateToken(&ssooidc.CreateTokenInput{
+			ClientId:     aws.String(token.ClientID),
+			ClientSecret: aws.String(token.ClientSecret),
+			DeviceCode:   auth.DeviceCode,
+			GrantType:    aws.String(ssoDeviceGrantType),
+		})
+		if err == nil {
+			token.AccessToken = aws.StringValue(res.AccessToken)
+			token.ExpiresAt = time.Now().Add(time.Duration(aws.Int64Value(res.ExpiresIn)) * time.Second)
+			return token, nil
+		}
+		aerr, ok := err.(awserr.Error)
+		switch {
+		case ok && aerr.Code() == ssooidc.ErrCodeAuthorizationPendingException:
+		case ok && aerr.Code() == ssooidc.ErrCodeSlowDownException:
+			interval += ssoSlowDown
+		case ok && aerr.Code() == ssooidc.ErrCodeExpiredTokenException:
+			return nil, fmt.Errorf("sso login was not confirmed in time")
+		default:
+			return nil, explainError(cfg, "sso-oidc:CreateToken", err)
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return nil, fmt.Errorf("sso login was not confirmed in time")
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ssoRoleCredentials returns the credentials of the configured role.
+func ssoRoleCredentials(api ssoiface.SSOAPI, cfg *config, token *ssoToken) (*sts.Credentials, error) {
+	res, err := api.GetRoleCredentials(&sso.GetRoleCredentialsInput{
+		AccessToken: aws.String(token.AccessToken),
+		AccountId:   aws.String(cfg.SSOAccountID),
+		RoleName:    aws.String(cfg.SSORoleName),
+	})
+	if err != nil {
+		return nil, explainError(cfg, "sso:GetRoleCredentials", err)
+	}
+	rc := res.RoleCredentials
+	expiration := time.Unix(0, aws.Int64Value(rc.Expiration)*int64(time.Millisecond))
+	return &sts.Credentials{
+		AccessKeyId:     rc.AccessKeyId,
+		SecretAccessKey: rc.SecretAccessKey,
+		SessionToken:    rc.SessionToken,
+		Expiration:      &expiration,
+	}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
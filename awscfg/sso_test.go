@@ -0,0 +1,119 @@
+package awscfg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sso"
+	"github.com/aws/aws-sdk-go/service/sso/ssoiface"
+	"github.com/aws/aws-sdk-go/service/ssooidc"
+	"github.com/aws/aws-sdk-go/service/ssooidc/ssooidciface"
+)
+
+// testOIDC confirms the login after pending polls.
+type testOIDC struct {
+	ssooidciface.SSOOIDCAPI
+	pending    int
+	registered int
+	polls      int
+}
+
+func (o *testOIDC) RegisterClient(in *ssooidc.RegisterClientInput) (*ssooidc.RegisterClientOutput, error) {
+	o.registered++
+	return &ssooidc.RegisterClientOutput{
+		ClientId:              aws.String("client"),
+		ClientSecret:          aws.String("secret"),
+		ClientSecretExpiresAt: aws.Int64(time.Now().Add(90 * 24 * time.Hour).Unix()),
+	}, nil
+}
+
+func (o *testOIDC) StartDeviceAuthorization(in *ssooidc.StartDeviceAuthorizationInput) (*ssooidc.StartDeviceAuthorizationOutput, error) {
+	return &ssooidc.StartDeviceAuthorizationOutput{
+		DeviceCode:              aws.String("device"),
+		UserCode:                aws.String("ABCD-EFGH"),
+		VerificationUriComplete: aws.String("https://device.sso.eu-west-1.amazonaws.com/?user_code=ABCD-EFGH"),
+		Interval:                aws.Int64(0),
+		ExpiresIn:               aws.Int64(600),
+	}, nil
+}
+
+func (o *testOIDC) CreateToken(in *ssooidc.CreateTokenInput) (*ssooidc.CreateTokenOutput, error) {
+	o.polls++
+	if o.polls <= o.pending {
+		return nil, awserr.New(ssooidc.ErrCodeAuthorizationPendingException, "pending", nil)
+	}
+	return &ssooidc.CreateTokenOutput{AccessToken: aws.String("token"), ExpiresIn: aws.Int64(28800)}, nil
+}
+
+type testSSO struct {
+	ssoiface.SSOAPI
+	in *sso.GetRoleCredentialsInput
+}
+
+func (s *testSSO) GetRoleCredentials(in *sso.GetRoleCredentialsInput) (*sso.GetRoleCredentialsOutput, error) {
+	s.in = in
+	return &sso.GetRoleCredentialsOutput{RoleCredentials: &sso.RoleCredentials{
+		AccessKeyId:     aws.String("ASIASSO"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("session"),
+		Expiration:      aws.Int64(1893456000000),
+	}}, nil
+}
+
+// testPrompter records notices.
+type testPrompter struct {
+	notices []string
+}
+
+func (p *testPrompter) prompt(ctx context.Context, msg string, secret bool) (string, error) {
+	return "", nil
+}
+
+func (p *testPrompter) notify(ctx context.Context, msg string) {
+	p.notices = append(p.notices, msg)
+}
+
+func TestSSOLogin(t *testing.T) {
+	cfg := &config{Type: typeSSO, SSOStartURL: "https://example.awsapps.com/start", SSOAccountID: "123456789012", SSORoleName: "admin"}
+	oidc := &testOIDC{pending: 2}
+	p := &testPrompter{}
+	token, err := ssoLogin(context.Background(), oidc, cfg, nil, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{token.AccessToken, "token"},
+		{token.tokenValid(time.Now()), true},
+		{oidc.registered, 1},
+		{oidc.polls, 3},
+		{len(p.notices), 1},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+
+	// the registered client is reused
+	if _, err := ssoLogin(context.Background(), oidc, cfg, token, p); err != nil {
+		t.Fatal(err)
+	}
+	if oidc.registered != 1 {
+		t.Errorf("expected client to be registered once, was %d times", oidc.registered)
+	}
+
+	api := &testSSO{}
+	creds, err := ssoRoleCredentials(api, cfg, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *creds.AccessKeyId != "ASIASSO" || creds.Expiration.Unix() != 1893456000 {
+		t.Errorf("unexpected credentials %v", creds)
+	}
+	if *api.in.AccountId != "123456789012" || *api.in.RoleName != "admin" || *api.in.AccessToken != "token" {
+		t.Errorf("unexpected input %v", api.in)
+	}
+}
@@ -0,0 +1,73 @@
+package awscfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// totpStep is the time step of the codes generated by MFA devices.
+const totpStep = 30 * time.Second
+
+// minCodeValidity is the time a code must stay valid for to be submitted.
+// AWS often rejects codes generated at the very end of their time step.
+const minCodeValidity = 2 * time.Second
+
+var errCodeUsed = fmt.Errorf("this code was already used, please wait for the next one")
+
+// usedCode is the last code submitted for an MFA device. AWS rejects codes
+// which were used before, which happens when sessions are refreshed back to
+// back.
+type usedCode struct {
+	Code string    `json:"code"`
+	Time time.Time `json:"time"`
+}
+
+func usedCodePath(cachePath, serial string) string {
+	name := strings.NewReplacer(":", "_", "/", "_").Replace(serial)
+	return filepath.Join(filepath.Dir(cachePath), "mfa-"+name+".json")
+}
+
+func readUsedCode(path string) *usedCode {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var u *usedCode
+	if err := json.NewDecoder(f).Decode(&u); err != nil {
+		dbg.Printf("error reading used code from %s: %s", path, err)
+		return nil
+	}
+	return u
+}
+
+func storeUsedCode(path, code string, now time.Time) error {
+	return storeCredentials(path, &usedCode{Code: code, Time: now})
+}
+
+// check returns errCodeUsed when code was already submitted within the time
+// AWS would still accept it.
+func (u *usedCode) check(code string, now time.Time) error {
+	if u != nil && u.Code == code && now.Sub(u.Time) < 3*totpStep {
+		return errCodeUsed
+	}
+	return nil
+}
+
+// codeWait returns how long to wait for the next time step before a code can
+// be generated which is neither about to expire nor was already used. code is
+// the code generated now or "" when no code was generated yet.
+func codeWait(last *usedCode, code string, now time.Time) time.Duration {
+	next := now.Truncate(totpStep).Add(totpStep)
+	if next.Sub(now) < minCodeValidity {
+		return next.Sub(now)
+	}
+	if code != "" && last.check(code, now) != nil {
+		return next.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package awscfg
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCodeWait(t *testing.T) {
+	step := time.Date(2019, 3, 28, 10, 0, 30, 0, time.UTC)
+	last := &usedCode{Code: "123456", Time: step.Add(-10 * time.Second)}
+	tests := []struct {
+		Name string
+		Last *usedCode
+		Code string
+		Now  time.Time
+		Want time.Duration
+	}{
+		{"no code yet", nil, "", step.Add(5 * time.Second), 0},
+		{"about to expire", nil, "", step.Add(29 * time.Second), time.Second},
+		{"fresh code", last, "234567", step.Add(5 * time.Second), 0},
+		{"used code", last, "123456", step.Add(5 * time.Second), 25 * time.Second},
+		{"used long ago", last, "123456", step.Add(5 * time.Minute), 0},
+	}
+	for _, tc := range tests {
+		if has := codeWait(tc.Last, tc.Code, tc.Now); has != tc.Want {
+			t.Errorf("%s: want=%s has=%s", tc.Name, tc.Want, has)
+		}
+	}
+}
+
+func TestUsedCode(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	p := usedCodePath(filepath.Join(dir, "KEY.json"), "arn:aws:iam::123456789012:mfa/alice")
+	if v, ex := p, filepath.Join(dir, "mfa-arn_aws_iam__123456789012_mfa_alice.json"); v != ex {
+		t.Errorf("expected path to be %q, was %q", ex, v)
+	}
+	if u := readUsedCode(p); u != nil {
+		t.Errorf("expected no used code, was %#v", u)
+	}
+	now := time.Now()
+	if err := storeUsedCode(p, "123456", now); err != nil {
+		t.Fatal(err)
+	}
+	u := readUsedCode(p)
+	if err := u.check("123456", now.Add(time.Second)); err != errCodeUsed {
+		t.Errorf("expected errCodeUsed, was %v", err)
+	}
+	if err := u.check("234567", now.Add(time.Second)); err != nil {
+		t.Errorf("expected no error, was %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package awscfg
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/phrase/aws-mfa/internal/levenshtein"
+)
+
+// invalidConfigError lists all problems of a config.
+type invalidConfigError struct {
+	path string
+	errs []error
+}
+
+func (e *invalidConfigError) Error() string {
+	lines := []string{}
+	for _, err := range e.errs {
+		lines = append(lines, e.path+": "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidateConfig reads the config at path and returns an error listing all
+// of its problems, if any. Of a shared credentials file, only the profile
+// aws-mfa uses is validated, other profiles may be used by other tools.
+func ValidateConfig(path string) error {
+	b, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	return validateConfig(path, b)
+}
+
+// validateConfig validates the config b read from path.
+func validateConfig(path string, b []byte) error {
+	cfg := &config{}
+	if configFormat(path, b) != formatShared {
+		if err := decodeConfig(path, b, cfg); err != nil {
+			return err
+		}
+		return cfg.check(path)
+	}
+	creds, err := parseLocalConfig(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	p := sharedProfile()
+	if err := decodeSharedProfile(path, creds, p, cfg); err != nil {
+		return err
+	}
+	invalid := &invalidConfigError{path: path}
+	for _, err := range cfg.validate() {
+		invalid.errs = append(invalid.errs, fmt.Errorf("[%s] %s", p, err))
+	}
+	if len(invalid.errs) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// check returns an invalidConfigError if cfg has problems.
+func (cfg *config) check(path string) error {
+	if errs := cfg.validate(); len(errs) > 0 {
+		return &invalidConfigError{path: path, errs: errs}
+	}
+	return nil
+}
+
+var policyARN = regexp.MustCompile(`^arn:[\w-]+:iam::(aws|\d{12}):policy/.+$`)
+
+// validate returns the problems of cfg: invalid durations, ARNs, regions and
+// endpoints as well as missing and conflicting options.
+func (cfg *config) validate() []error {
+	errs := []error{}
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch cfg.Type {
+	case "", typeIAMUser:
+		for _, k := range []struct{ name, value, command string }{
+			{"aws_access_key_id", cfg.AWSAccessKeyID, cfg.AWSAccessKeyIDCommand},
+			{"aws_secret_access_key", cfg.AWSSecretAccessKey, cfg.AWSSecretAccessKeyCommand},
+		} {
+			switch {
+			case k.value == "" && k.command == "":
+				add("%s or %s_command is required", k.name, k.name)
+			case k.value != "" && k.command != "":
+				add("%s and %s_command conflict, use only one", k.name, k.name)
+			}
+			if err := checkReference(k.name, k.value); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case typeSSO:
+		if cfg.SSOStartURL == "" || cfg.SSOAccountID == "" || cfg.SSORoleName == "" {
+			add("sso configs require sso_start_url, sso_account_id and sso_role_name")
+		}
+		if cfg.SSORegion != "" {
+			if err := checkRegion("sso_region", cfg.SSORegion); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case typeWebIdentity:
+		if cfg.WebIdentityRoleARN == "" {
+			add("web_identity configs require web_identity_role_arn")
+		} else if _, err := roleARN(cfg, cfg.WebIdentityRoleARN); err != nil {
+			add("web_identity_role_arn: %s", err)
+		}
+		if (cfg.WebIdentityTokenFile == "") == (cfg.WebIdentityTokenCommand == "") {
+			add("web_identity configs require either web_identity_token_file or web_identity_token_command")
+		}
+	default:
+		add("type: unknown type %q, use %s, %s or %s", cfg.Type, typeIAMUser, typeSSO, typeWebIdentity)
+	}
+	if cfg.Type != "" && cfg.Type != typeIAMUser {
+		if cfg.AWSYubikey != "" {
+			add("aws_yubikey is only used by %s configs", typeIAMUser)
+		}
+		if chainRequiresMFA(cfg.RoleChain) {
+			add("role_chain: mfa requires an %s config", typeIAMUser)
+		}
+	}
+
+	if cfg.AWSDefaultRegion != "" {
+		if err := checkRegion("aws_default_region", cfg.AWSDefaultRegion); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.AWSDuration != "" {
+		if d, err := parseDuration(cfg.AWSDuration); err != nil {
+			add("aws_duration: %s", err)
+		} else if !cfg.AWSAutoClamp {
+			limits := sessionTokenLimits
+			if cfg.Type == typeWebIdentity {
+				limits = roleLimits
+			}
+			if _, err := limits.check("aws_duration", d, false); err != nil {
+				add("%s", err)
+			}
+		}
+	}
+	if cfg.AWSYubikeyWait != "" {
+		if _, err := time.ParseDuration(cfg.AWSYubikeyWait); err != nil {
+			add("aws_yubikey_wait: %s", err)
+		}
+	}
+	if cfg.AWSPrompt != "" && cfg.AWSPrompt != "terminal" && findFrontend(cfg.AWSPrompt) == nil {
+		add("aws_prompt: unknown prompt %q", cfg.AWSPrompt)
+	}
+	for _, e := range []struct{ name, value string }{
+		{"aws_sts_endpoint", cfg.AWSSTSEndpoint},
+		{"aws_iam_endpoint", cfg.AWSIAMEndpoint},
+		{"aws_federation_endpoint", cfg.AWSFederationEndpoint},
+		{"sso_start_url", cfg.SSOStartURL},
+	} {
+		if u, err := url.Parse(e.value); e.value != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+			add("%s: %q is not a URL", e.name, e.value)
+		}
+	}
+
+	chain := cfg.roleChain()
+	for i, h := range chain {
+		if h.RoleARN == "" {
+			add("role_chain[%d]: role_arn missing", i)
+			continue
+		}
+		if _, err := roleARN(cfg, h.RoleARN); err != nil {
+			add("%s", err)
+		}
+		if h.Duration == "" {
+			continue
+		}
+		limits := roleLimits
+		if cfg.chainedHop(i) {
+			limits = chainedRoleLimits
+		}
+		if d, err := parseDuration(h.Duration); err != nil {
+			add("duration of role %s: %s", h.RoleARN, err)
+		} else if !cfg.AWSAutoClamp {
+			if _, err := limits.check("duration of role "+h.RoleARN, d, false); err != nil {
+				add("%s", err)
+			}
+		}
+	}
+	if len(chain) == 0 {
+		for _, name := range []string{"role_session_name", "role_duration", "tags", "transitive_tag_keys", "source_identity", "policy", "policy_arns"} {
+			if isSet(cfg, name) {
+				add("%s requires role_arn or role_chain", name)
+			}
+		}
+	}
+	for _, k := range cfg.TransitiveTagKeys {
+		if _, ok := cfg.Tags[k]; !ok {
+			add("transitive_tag_keys: %q is not a key of tags", k)
+		}
+	}
+	if cfg.Policy != "" {
+		if _, err := readPolicy(cfg.Policy); err != nil {
+			add("%s", err)
+		}
+	}
+	for _, arn := range cfg.PolicyARNs {
+		if !policyARN.MatchString(arn) {
+			add("policy_arns: %q is not the ARN of a policy", arn)
+		}
+	}
+	return errs
+}
+
+// checkRegion returns an error if region is not the name of a region. As
+// the SDK does not know regions launched after its release, names which only
+// differ in the number from known ones are accepted too.
+func checkRegion(setting, region string) error {
+	if _, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); !ok {
+		return fmt.Errorf("%s: unknown region %q", setting, region)
+	}
+	prefix := strings.TrimRight(region, "0123456789")
+	best, bestDistance := "", 3
+	for _, p := range endpoints.DefaultPartitions() {
+		for r := range p.Regions() {
+			if strings.TrimRight(r, "0123456789") == prefix {
+				return nil
+			}
+			if d := levenshtein.Distance(r, region); d < bestDistance || (d == bestDistance && r < best) {
+				best, bestDistance = r, d
+			}
+		}
+	}
+	if best != "" {
+		return fmt.Errorf("%s: unknown region %q, did you mean %q?", setting, region, best)
+	}
+	return nil
+}
+
+// isSet returns true when the field with the json name name is not empty.
+func isSet(cfg *config, name string) bool {
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if jsonName(v.Type().Field(i)) == name {
+			f := v.Field(i)
+			return !reflect.DeepEqual(f.Interface(), reflect.Zero(f.Type()).Interface())
+		}
+	}
+	return false
+}
+
+// fieldNames returns the json names of the fields of the struct type t.
+func fieldNames(t reflect.Type) []string {
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, jsonName(t.Field(i)))
+	}
+	return names
+}
+
+// unknownField returns the message for the unknown field key, suggesting the
+// closest of names.
+func unknownField(key string, names []string) string {
+	msg := fmt.Sprintf("unknown field %q", key)
+	field := key[strings.LastIndex(key, ".")+1:]
+	best, bestDistance := "", 4
+	for _, n := range names {
+		if d := levenshtein.Distance(field, n); d < bestDistance {
+			best, bestDistance = n, d
+		}
+	}
+	if best != "" {
+		msg += fmt.Sprintf(", did you mean %q?", best)
+	}
+	return msg
+}
@@ -0,0 +1,114 @@
+package awscfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	user := config{AWSAccessKeyID: "AKIA", AWSSecretAccessKey: "secret"}
+	with := func(f func(cfg *config)) *config {
+		cfg := user
+		f(&cfg)
+		return &cfg
+	}
+	tests := []struct {
+		Has  *config
+		Want []string
+	}{
+		{&user, []string{}},
+		{&config{}, []string{"aws_access_key_id or aws_access_key_id_command is required", "aws_secret_access_key or aws_secret_access_key_command is required"}},
+		{&config{AWSAccessKeyID: "env:", AWSSecretAccessKeyCommand: "pass aws"}, []string{`aws_access_key_id: "env:" is missing a name`}},
+		{with(func(c *config) { c.AWSSecretAccessKeyCommand = "pass aws" }), []string{"aws_secret_access_key and aws_secret_access_key_command conflict, use only one"}},
+		{with(func(c *config) { c.Type = "saml" }), []string{`type: unknown type "saml", use iam_user, sso or web_identity`}},
+		{with(func(c *config) { c.AWSDefaultRegion = "eu-wst-1" }), []string{`aws_default_region: unknown region "eu-wst-1", did you mean "eu-west-1"?`}},
+		{with(func(c *config) { c.AWSDefaultRegion = "mars-1" }), []string{`aws_default_region: unknown region "mars-1"`}},
+		{with(func(c *config) { c.AWSDefaultRegion = "eu-north-9" }), []string{}},
+		{with(func(c *config) { c.AWSDuration = "1 hour" }), []string{`aws_duration: time: unknown unit " hour" in duration "1 hour"`}},
+		{with(func(c *config) { c.AWSDuration = "2d" }), []string{"aws_duration 48h is out of range, session tokens last between 15m and 36h (use --auto-clamp to use 36h)"}},
+		{with(func(c *config) { c.AWSDuration, c.AWSAutoClamp = "2d", true }), []string{}},
+		{with(func(c *config) { c.AWSYubikeyWait = "long" }), []string{`aws_yubikey_wait: time: invalid duration "long"`}},
+		{with(func(c *config) { c.AWSPrompt = "gui" }), []string{`aws_prompt: unknown prompt "gui"`}},
+		{with(func(c *config) { c.AWSSTSEndpoint = "localhost:8080" }), []string{`aws_sts_endpoint: "localhost:8080" is not a URL`}},
+		{with(func(c *config) { c.RoleDuration = "1h" }), []string{"role_duration requires role_arn or role_chain"}},
+		{with(func(c *config) { c.RoleARN = "admin" }), []string{`invalid role "admin", expected e.g. arn:aws:iam::123456789012:role/admin`}},
+		{with(func(c *config) {
+			c.RoleChain = []roleHop{{RoleARN: "123456789012:role/a"}, {Duration: "1h"}}
+			c.RoleARN, c.RoleDuration = "123456789012:role/b", "2h"
+		}), []string{
+			"role_chain[1]: role_arn missing",
+			"duration of role 123456789012:role/b 2h is out of range, role sessions assumed by role chaining last between 15m and 1h (use --auto-clamp to use 1h)",
+		}},
+		{with(func(c *config) {
+			c.RoleARN, c.Tags, c.TransitiveTagKeys = "123456789012:role/a", map[string]string{"team": "a"}, []string{"project"}
+			c.PolicyARNs = []string{"arn:aws:iam::aws:policy/ReadOnlyAccess", "ReadOnlyAccess"}
+		}), []string{
+			`transitive_tag_keys: "project" is not a key of tags`,
+			`policy_arns: "ReadOnlyAccess" is not the ARN of a policy`,
+		}},
+		{&config{Type: typeSSO, SSOStartURL: "https://example.awsapps.com/start", SSORegion: "eu-west-1", SSOAccountID: "123456789012", SSORoleName: "admin"}, []string{}},
+		{&config{Type: typeSSO, SSORegion: "eu-west-1", AWSYubikey: "aws"}, []string{
+			"sso configs require sso_start_url, sso_account_id and sso_role_name",
+			"aws_yubikey is only used by iam_user configs",
+		}},
+		{&config{Type: typeSSO, SSOStartURL: "https://example.awsapps.com/start", SSORegion: "eu-west-1", SSOAccountID: "123456789012", SSORoleName: "admin", RoleARN: "123456789012:role/a", RoleDuration: "2h"}, []string{
+			"duration of role 123456789012:role/a 2h is out of range, role sessions assumed by role chaining last between 15m and 1h (use --auto-clamp to use 1h)",
+		}},
+		{&config{Type: typeWebIdentity, WebIdentityRoleARN: "123456789012:role/ci", WebIdentityTokenFile: "token", AWSDuration: "13h"}, []string{
+			"aws_duration 13h is out of range, role sessions last between 15m and 12h (use --auto-clamp to use 12h)",
+		}},
+		{&config{Type: typeWebIdentity, WebIdentityRoleARN: "123456789012:role/ci", WebIdentityTokenFile: "token", WebIdentityTokenCommand: "cat token"}, []string{
+			"web_identity configs require either web_identity_token_file or web_identity_token_command",
+		}},
+		{&config{Type: typeWebIdentity, WebIdentityTokenFile: "token", RoleChain: []roleHop{{RoleARN: "123456789012:role/a", MFA: true}}}, []string{
+			"web_identity configs require web_identity_role_arn",
+			"role_chain: mfa requires an iam_user config",
+		}},
+	}
+	for i, tc := range tests {
+		has := []string{}
+		for _, err := range tc.Has.validate() {
+			has = append(has, err.Error())
+		}
+		if !reflect.DeepEqual(tc.Want, has) {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, has)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	writeFiles(t, dir, map[string]string{
+		"aws.yaml":         "aws_access_key_id: AKIA\naws_secret_access_key: secret\naws_default_region: eu-west-1\n",
+		".aws/credentials": "[default]\naws_access_key_id = AKIA\naws_secret_access_key = secret\n\n[ci]\naws_access_key_id = AKIA\naws_duration = 2d\n\n[temp]\naws_session_token = token\n",
+	})
+	if err := ValidateConfig(filepath.Join(dir, "aws.yaml")); err != nil {
+		t.Errorf("expected aws.yaml to be valid, was %s", err)
+	}
+	// only the profile used is validated
+	defer setenv(t, map[string]string{"AWS_PROFILE": ""})()
+	path := filepath.Join(dir, ".aws/credentials")
+	if err := ValidateConfig(path); err != nil {
+		t.Errorf("expected default profile to be valid, was %s", err)
+	}
+	os.Setenv("AWS_PROFILE", "ci")
+	want := path + ": [ci] aws_secret_access_key or aws_secret_access_key_command is required\n" +
+		path + ": [ci] aws_duration 48h is out of range, session tokens last between 15m and 36h (use --auto-clamp to use 36h)"
+	if err := ValidateConfig(path); err == nil || err.Error() != want {
+		t.Errorf("want=%q has=%v", want, err)
+	}
+
+	// validation errors are returned when loading
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "aws.yaml"))
+	bad := filepath.Join(dir, "bad.yaml")
+	if err := ioutil.WriteFile(bad, append(b, "role_duration: 1h\n"...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFromPath(bad); err == nil || err.Error() != bad+": role_duration requires role_arn or role_chain" {
+		t.Errorf("expected role_duration error, was %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package awscfg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// getWebIdentityCredentials assumes web_identity_role_arn with the OIDC token
+// read from web_identity_token_file or the output of
+// web_identity_token_command, e.g. a token issued by a CI provider. The
+// session lasts aws_duration (one hour by default). The credentials are
+// cached per role, session name, duration and token.
+func getWebIdentityCredentials(cfg *config) (*sts.Credentials, error) {
+	if cfg.WebIdentityRoleARN == "" {
+		return nil, fmt.Errorf("web_identity configurations require web_identity_role_arn")
+	}
+	arn, err := roleARN(cfg, cfg.WebIdentityRoleARN)
+	if err != nil {
+		return nil, err
+	}
+	token, err := readWebIdentityToken(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dur := defaultRoleDuration
+	if cfg.AWSDuration != "" {
+		if dur, err = parseDuration(cfg.AWSDuration); err != nil {
+			return nil, fmt.Errorf("aws_duration: %s", err)
+		}
+	}
+	if dur, err = roleLimits.check("aws_duration", dur, cfg.AWSAutoClamp); err != nil {
+		return nil, err
+	}
+	name := cfg.RoleSessionName
+	if name == "" {
+		name = defaultSessionName()
+	}
+	key := sha256.Sum256([]byte(arn + "\n" + name + "\n" + dur.String() + "\n" + token))
+	cachePath := filepath.Join(cacheDir, "web-identity-"+hex.EncodeToString(key[:8])+".json")
+	if creds := readCachedCredentials(cfg, cachePath); creds != nil {
+		return creds, nil
+	}
+	stsClient := sts.New(session.New(stsConfig(cfg, credentials.AnonymousCredentials)))
+	res, err := stsClient.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(arn),
+		RoleSessionName:  aws.String(name),
+		WebIdentityToken: aws.String(token),
+		DurationSeconds:  aws.Int64(int64(dur.Seconds())),
+	})
+	if err != nil {
+		return nil, explainError(cfg, "sts:AssumeRoleWithWebIdentity", err)
+	}
+	if err := storeCredentials(cachePath, res.Credentials); err != nil {
+		log.Printf("error storing credentials: %s", err)
+	}
+	return res.Credentials, nil
+}
+
+func readWebIdentityToken(cfg *config) (string, error) {
+	switch {
+	case cfg.WebIdentityTokenFile != "":
+		b, err := ioutil.ReadFile(cfg.WebIdentityTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading web identity token: %s", err)
+		}
+		if token := strings.TrimSpace(string(b)); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("web identity token file %s is empty", cfg.WebIdentityTokenFile)
+	case cfg.WebIdentityTokenCommand != "":
+		return runSecretCommand(context.Background(), cfg.WebIdentityTokenCommand)
+	}
+	return "", fmt.Errorf("web_identity configurations require web_identity_token_file or web_identity_token_command")
+}
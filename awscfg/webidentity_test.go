@@ -0,0 +1,59 @@
+package awscfg
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWebIdentityCredentials(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer func(dir string) { cacheDir = dir }(cacheDir)
+	cacheDir = dir
+
+	srv := newTestSTS(t)
+	defer srv.Close()
+
+	tokenPath := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenPath, []byte("header.payload.signature\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfgs := []*config{
+		{Type: typeWebIdentity, WebIdentityRoleARN: "arn:aws:iam::123456789012:role/ci", WebIdentityTokenFile: tokenPath, AWSSTSEndpoint: srv.URL, AWSDefaultRegion: "eu-west-1"},
+		{Type: typeWebIdentity, WebIdentityRoleARN: "arn:aws:iam::123456789012:role/ci", WebIdentityTokenCommand: "echo header.payload.signature", AWSSTSEndpoint: srv.URL, AWSDefaultRegion: "eu-west-1"},
+	}
+	for i, cfg := range cfgs {
+		creds, err := baseCredentials(cfg)
+		if err != nil {
+			t.Fatalf("%d: %s", i+1, err)
+		}
+		if *creds.AccessKeyId != "ASIA-ci" {
+			t.Errorf("%d: unexpected credentials %v", i+1, creds)
+		}
+	}
+	if want := "AssumeRoleWithWebIdentity - ci"; len(srv.requests) != 1 || srv.requests[0] != want {
+		t.Errorf("expected one unsigned request with cached credentials of the same token, was %q", srv.requests)
+	} else if f := srv.forms[0]; f.Get("WebIdentityToken") != "header.payload.signature" || f.Get("DurationSeconds") != "3600" {
+		t.Errorf("unexpected token %q or duration %s", f.Get("WebIdentityToken"), f.Get("DurationSeconds"))
+	}
+
+	// aws_duration sets the duration of the session
+	cfg := *cfgs[0]
+	cfg.AWSDuration = "2h"
+	if _, err := baseCredentials(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.forms) != 2 || srv.forms[1].Get("DurationSeconds") != "7200" {
+		t.Errorf("expected a 2h session, was %q", srv.requests)
+	}
+	cfg.AWSDuration = "13h"
+	if _, err := baseCredentials(&cfg); err == nil || !strings.Contains(err.Error(), "role sessions last between 15m and 12h") {
+		t.Errorf("expected duration error, was %v", err)
+	}
+
+	if _, err := baseCredentials(&config{Type: typeWebIdentity, WebIdentityRoleARN: "arn:aws:iam::123456789012:role/ci"}); err == nil {
+		t.Error("expected error without token")
+	}
+}
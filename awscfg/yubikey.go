@@ -0,0 +1,51 @@
+package awscfg
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/phrase/aws-mfa/yubiauth"
+)
+
+// ListYubikeys prints all connected yubikeys and their OATH accounts to w.
+// When path is not empty, the account matching aws_yubikey is marked.
+func ListYubikeys(path string, w io.Writer) error {
+	cfg := &config{}
+	if path != "" {
+		var err error
+		if cfg, _, err = resolveConfig(path, nil); err != nil {
+			return err
+		}
+	}
+	devices, err := yubiauth.Devices(yubiOptions(context.Background(), cfg, newPrompter(cfg)))
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return fmt.Errorf("no yubikey connected")
+	}
+	for _, d := range devices {
+		serial := d.Serial
+		if serial == "" {
+			serial = "unknown serial"
+		}
+		fmt.Fprintf(w, "%s (%s)\n", d.Description, serial)
+		var match string
+		if cfg.AWSYubikey != "" {
+			keys := yubiauth.Keys{}
+			for _, a := range d.Accounts {
+				keys[a] = ""
+			}
+			match, _ = keys.Match(cfg.AWSYubikey)
+		}
+		for _, a := range d.Accounts {
+			marker := " "
+			if a == match {
+				marker = "*"
+			}
+			fmt.Fprintf(w, "  %s %s\n", marker, a)
+		}
+	}
+	return nil
+}
@@ -3,9 +3,11 @@ module github.com/phrase/aws-mfa
 go 1.12
 
 require (
-	github.com/aws/aws-sdk-go v1.15.70
-	github.com/phrase/awscfg v0.0.0-20181107074734-741c0a4fbe68
-	github.com/phrase/yubioath v0.0.0-20181107085049-de4cff23725c // indirect
-	github.com/stretchr/testify v1.3.0 // indirect
-	golang.org/x/net v0.0.0-20190327214358-63eda1eb0650 // indirect
+	github.com/ProtonMail/go-crypto v0.0.0-20220113124808-70ae35bab23f
+	github.com/aws/aws-sdk-go v1.46.7
+	github.com/gballet/go-libpcsclite v0.0.0-20190607065134-2772fd86a8ff
+	github.com/pelletier/go-toml v1.9.5
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+	golang.org/x/term v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
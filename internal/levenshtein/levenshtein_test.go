@@ -0,0 +1,20 @@
+package levenshtein
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		A, B string
+		Want int
+	}{
+		{"aws_yubikey", "aws_yubikey", 0},
+		{"aws_yubi_key", "aws_yubikey", 1},
+		{"durration", "duration", 1},
+		{"", "mfa", 3},
+	}
+	for i, tc := range tests {
+		if has := Distance(tc.A, tc.B); has != tc.Want {
+			t.Errorf("%d: want=%d has=%d", i+1, tc.Want, has)
+		}
+	}
+}
@@ -1,24 +1,91 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/phrase/awscfg"
+	"github.com/phrase/aws-mfa/awscfg"
 )
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, err.Error())
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+var (
+	opts       = &awscfg.Options{Tags: map[string]string{}}
+	configPath = flag.String("config", "", "path of the config (default $AWS_CREDENTIALS_PATH or the first one found)")
+)
+
+func init() {
+	flag.StringVar(&opts.RoleARN, "role-arn", "", "ARN of the role to assume")
+	flag.StringVar(&opts.RoleSessionName, "role-session-name", "", "name of the assumed role session")
+	flag.Var(tagsFlag(opts.Tags), "tag", "session tag as key=value, can be repeated")
+	flag.Var((*listFlag)(&opts.TransitiveTagKeys), "transitive-tag-key", "key of a session tag passed on to chained roles, can be repeated")
+	flag.StringVar(&opts.SourceIdentity, "source-identity", "", "source identity of the assumed role session")
+	flag.StringVar(&opts.Policy, "policy", "", "session policy as inline JSON or path of a file")
+	flag.Var((*listFlag)(&opts.PolicyARNs), "policy-arn", "ARN of a managed session policy, can be repeated")
+	flag.BoolVar(&opts.AutoClamp, "auto-clamp", false, "use the closest allowed session duration instead of failing")
+}
+
+// tagsFlag collects key=value flags.
+type tagsFlag map[string]string
+
+func (f tagsFlag) String() string {
+	return ""
+}
+
+func (f tagsFlag) Set(v string) error {
+	parts := strings.SplitN(v, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("tag %q must be key=value", v)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// listFlag collects repeated flags.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return ""
+}
+
+func (f *listFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
 func run() error {
+	flag.Parse()
+	switch flag.Arg(0) {
+	case "yubikey":
+		return runYubikey(flag.Args()[1:])
+	case "federate":
+		return runFederate(flag.Args()[1:])
+	case "console":
+		return runConsole(flag.Args()[1:])
+	case "config":
+		return runConfig(flag.Args()[1:])
+	case "doctor":
+		return runDoctor(flag.Args()[1:])
+	case "init":
+		if flag.NArg() > 2 {
+			return errors.New("usage: aws-mfa init [path]")
+		}
+		return awscfg.Init(firstNonEmpty(flag.Arg(1), *configPath, awscfg.DefaultConfigPath()), os.Stdout)
+	}
 	cfg, err := loadConfig()
 	if err != nil {
 		return err
@@ -27,25 +94,262 @@ func run() error {
 	if err != nil {
 		return err
 	}
-	flag.Parse()
-	if flag.Arg(0) == "env" {
-		for _, e := range ae {
-			fmt.Println("export " + e)
+	switch flag.Arg(0) {
+	case "env":
+		fs := flag.NewFlagSet("env", flag.ExitOnError)
+		format := fs.String("format", "sh", envFormatsUsage)
+		fs.Parse(flag.Args()[1:])
+		return writeEnv(os.Stdout, *format, ae)
+	case "exec":
+		args := flag.Args()[1:]
+		if len(args) > 0 && args[0] == "--" {
+			args = args[1:]
 		}
-		return nil
-	}
-	args := []string{}
-	if len(os.Args) > 1 {
-		args = os.Args[1:]
+		if len(args) == 0 {
+			return errors.New("usage: aws-mfa exec [--] <command> [args...]")
+		}
+		return runCommand(args[0], args[1:], ae)
+	case "credential-process":
+		return writeCredentialProcess(os.Stdout, cfg)
 	}
-	c := exec.Command("aws", args...)
-	c.Env = append(os.Environ(), ae...)
+	return runCommand("aws", flag.Args(), ae)
+}
+
+func runCommand(name string, args, env []string) error {
+	c := exec.Command(name, args...)
+	c.Env = append(os.Environ(), env...)
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
 	c.Stdin = os.Stdin
 	return c.Run()
 }
 
+// writeCredentialProcess prints the credentials of cfg in the format of the
+// credential_process setting of the AWS config.
+func writeCredentialProcess(w io.Writer, cfg *aws.Config) error {
+	c, err := cfg.Credentials.Get()
+	if err != nil {
+		return err
+	}
+	out := struct {
+		Version         int
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      string `json:",omitempty"`
+	}{Version: 1, AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken}
+	if exp, err := cfg.Credentials.ExpiresAt(); err == nil && !exp.IsZero() {
+		out.Expiration = exp.UTC().Format(time.RFC3339)
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+func runYubikey(args []string) error {
+	if len(args) != 1 || args[0] != "list" {
+		return errors.New("usage: aws-mfa yubikey list")
+	}
+	// the accounts of all keys are listed without a config
+	p, _ := awscfg.FindConfig(*configPath)
+	return awscfg.ListYubikeys(p, os.Stdout)
+}
+
+const configUsage = "usage: aws-mfa config validate [path...] | edit [path] | show [--resolved] [path]"
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+	switch args[0] {
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "edit":
+		return runConfigEdit(args[1:])
+	case "show":
+		return runConfigShow(args[1:])
+	}
+	return errors.New(configUsage)
+}
+
+// runConfigValidate validates the configs at paths or, without any, the one
+// chosen with --config or AWS_CREDENTIALS_PATH or all configs found.
+func runConfigValidate(paths []string) error {
+	if len(paths) == 0 && *configPath != "" {
+		paths = []string{*configPath}
+	}
+	if len(paths) == 0 {
+		var err error
+		if paths, err = awscfg.FindConfigs(); err != nil {
+			return err
+		}
+	}
+	invalid := 0
+	for _, p := range paths {
+		if err := awscfg.ValidateConfig(p); err != nil {
+			fmt.Println(err)
+			invalid++
+			continue
+		}
+		fmt.Printf("%s: ok\n", p)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d configs are invalid", invalid, len(paths))
+	}
+	return nil
+}
+
+func runConfigEdit(args []string) error {
+	if len(args) > 1 {
+		return errors.New(configUsage)
+	}
+	p, err := awscfg.FindConfig(firstNonEmpty(strings.Join(args, ""), *configPath))
+	if err != nil {
+		return err
+	}
+	return awscfg.EditConfig(p)
+}
+
+func runConfigShow(args []string) error {
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	resolved := fs.Bool("resolved", false, "apply the AWS_MFA_* environment variables and flags and print the source of every value")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		return errors.New(configUsage)
+	}
+	p, err := awscfg.FindConfig(firstNonEmpty(fs.Arg(0), *configPath))
+	if err != nil {
+		return err
+	}
+	return awscfg.ShowConfig(os.Stdout, p, opts, *resolved)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// runDoctor checks the config in use and the permissions of it and of the
+// cached sessions, or only the permissions with --permissions.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	permissions := fs.Bool("permissions", false, "only check that the config and cached sessions are only accessible by you")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return errors.New("usage: aws-mfa doctor [--permissions]")
+	}
+	p, err := awscfg.FindConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	var invalid error
+	if !*permissions {
+		if invalid = awscfg.ValidateConfig(p); invalid != nil {
+			fmt.Println(invalid)
+		} else {
+			fmt.Printf("%s: valid\n", p)
+		}
+	}
+	if err := awscfg.CheckPermissions(os.Stdout, p); err != nil {
+		return err
+	}
+	if invalid != nil {
+		return errors.New("the config is invalid")
+	}
+	return nil
+}
+
+func runFederate(args []string) error {
+	fs := flag.NewFlagSet("federate", flag.ExitOnError)
+	name := fs.String("name", "", "name of the federated user (required)")
+	policy := fs.String("policy", "", "session policy as inline JSON or path of a file")
+	dur := fs.String("duration", "1h", "duration of the session, e.g. 1h or 1d")
+	format := fs.String("format", "sh", envFormatsUsage)
+	fs.Parse(args)
+	if *name == "" || fs.NArg() > 0 {
+		return errors.New("usage: aws-mfa federate --name <name> [--policy <file>] [--duration 1h] [--format sh]")
+	}
+	p, err := awscfg.FindConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "warning: "+awscfg.FederationWarning)
+	if *policy == "" {
+		fmt.Fprintln(os.Stderr, "warning: without --policy the session has no permissions")
+	}
+	cfg, err := awscfg.Federate(p, opts, *name, *policy, *dur)
+	if err != nil {
+		return err
+	}
+	ae, err := awsEnv(cfg)
+	if err != nil {
+		return err
+	}
+	return writeEnv(os.Stdout, *format, ae)
+}
+
+func runConsole(args []string) error {
+	fs := flag.NewFlagSet("console", flag.ExitOnError)
+	service := fs.String("service", "", "console of the service to open, e.g. ec2")
+	region := fs.String("region", "", "region to open the console in (default aws_default_region)")
+	printURL := fs.Bool("print", false, "print the sign-in URL instead of opening it")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return errors.New("usage: aws-mfa console [--service ec2] [--region eu-west-1] [--print]")
+	}
+	p, err := awscfg.FindConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	u, err := awscfg.ConsoleURL(p, opts, *service, *region)
+	if err != nil {
+		return err
+	}
+	if !*printURL {
+		if err := openURL(u); err == nil {
+			return nil
+		}
+	}
+	fmt.Println(u)
+	return nil
+}
+
+// openURL opens u in the default browser.
+func openURL(u string) error {
+	name := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		name = "open"
+	}
+	return exec.Command(name, u).Run()
+}
+
+const envFormatsUsage = "output format: sh, fish, powershell or dotenv"
+
+// writeEnv prints the KEY=value pairs of env in format. Values are not
+// quoted as credentials and regions contain no special characters.
+func writeEnv(w io.Writer, format string, env []string) error {
+	var line string
+	switch format {
+	case "sh":
+		line = "export %s=%s\n"
+	case "fish":
+		line = "set -gx %s %s\n"
+	case "powershell":
+		line = "$Env:%s = \"%s\"\n"
+	case "dotenv":
+		line = "%s=%s\n"
+	default:
+		return fmt.Errorf("unknown format %q, use sh, fish, powershell or dotenv", format)
+	}
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		fmt.Fprintf(w, line, kv[0], kv[1])
+	}
+	return nil
+}
+
 func awsEnv(cfg *aws.Config) (out []string, err error) {
 	c, err := cfg.Credentials.Get()
 	if err != nil {
@@ -66,9 +370,9 @@ func awsEnv(cfg *aws.Config) (out []string, err error) {
 }
 
 func loadConfig() (*aws.Config, error) {
-	p := os.Getenv("AWS_CREDENTIALS_PATH")
-	if p == "" {
-		return nil, errors.New("AWS_CREDENTIALS_PATH must be set")
+	p, err := awscfg.FindConfig(*configPath)
+	if err != nil {
+		return nil, err
 	}
-	return awscfg.NewFromPath(p)
+	return awscfg.NewFromPathWithOptions(p, opts)
 }
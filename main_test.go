@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteEnv(t *testing.T) {
+	env := []string{"AWS_ACCESS_KEY_ID=ASIA", "AWS_SESSION_TOKEN=a=b"}
+	tests := []struct {
+		Format string
+		Want   string
+	}{
+		{"sh", "export AWS_ACCESS_KEY_ID=ASIA\nexport AWS_SESSION_TOKEN=a=b\n"},
+		{"fish", "set -gx AWS_ACCESS_KEY_ID ASIA\nset -gx AWS_SESSION_TOKEN a=b\n"},
+		{"powershell", "$Env:AWS_ACCESS_KEY_ID = \"ASIA\"\n$Env:AWS_SESSION_TOKEN = \"a=b\"\n"},
+		{"dotenv", "AWS_ACCESS_KEY_ID=ASIA\nAWS_SESSION_TOKEN=a=b\n"},
+	}
+	for i, tc := range tests {
+		buf := &bytes.Buffer{}
+		if err := writeEnv(buf, tc.Format, env); err != nil {
+			t.Errorf("%d: %s", i+1, err)
+		} else if buf.String() != tc.Want {
+			t.Errorf("%d: want=%q has=%q", i+1, tc.Want, buf.String())
+		}
+	}
+	if err := writeEnv(&bytes.Buffer{}, "cmd", env); err == nil {
+		t.Error("expected error of unknown format")
+	}
+}
@@ -0,0 +1,118 @@
+package yubiauth
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/phrase/aws-mfa/internal/levenshtein"
+)
+
+// Account is an OATH account name split into its issuer and name parts, e.g.
+// "Amazon Web Services:alice@123456789012".
+type Account struct {
+	Issuer string
+	Name   string
+}
+
+var periodPrefix = regexp.MustCompile(`^\d+/`)
+
+// ParseAccount splits s into issuer and name. Names without issuer have an
+// empty Issuer. A period prefix (e.g. "60/") is ignored.
+func ParseAccount(s string) Account {
+	s = periodPrefix.ReplaceAllString(strings.Join(strings.Fields(s), " "), "")
+	if i := strings.Index(s, ":"); i >= 0 {
+		return Account{Issuer: strings.TrimSpace(s[:i]), Name: strings.TrimSpace(s[i+1:])}
+	}
+	return Account{Name: s}
+}
+
+func (a Account) String() string {
+	if a.Issuer == "" {
+		return a.Name
+	}
+	return a.Issuer + ":" + a.Name
+}
+
+var (
+	mfaARN    = regexp.MustCompile(`^arn:aws[a-z-]*:iam::(\d{12}):mfa/(?:.*/)?([^/]+)$`)
+	accountID = regexp.MustCompile(`^\d{12}$`)
+)
+
+// Match returns the name of the key matching query. A query matches keys
+//
+//   - with exactly this name,
+//   - with this name ignoring case, whitespace and a period prefix,
+//   - whose name without issuer is query,
+//   - for the user and account of query if it is the ARN of an MFA device, or
+//   - for the account if query is a 12 digit account id.
+//
+// The first of these rules with any matches is used. It is an error when it
+// matches more than one key.
+func (k Keys) Match(query string) (string, error) {
+	if k.has(query) {
+		return query, nil
+	}
+	names := make([]string, 0, len(k))
+	for n := range k {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	q := ParseAccount(query)
+	rules := []func(Account) bool{
+		func(a Account) bool { return strings.EqualFold(a.String(), q.String()) },
+		func(a Account) bool { return q.Issuer == "" && strings.EqualFold(a.Name, q.Name) },
+	}
+	if m := mfaARN.FindStringSubmatch(query); m != nil {
+		rules = append(rules, func(a Account) bool {
+			return strings.EqualFold(a.Name, m[2]+"@"+m[1])
+		})
+	} else if accountID.MatchString(query) {
+		rules = append(rules, func(a Account) bool {
+			return strings.Contains(a.Name, query)
+		})
+	}
+	for _, r := range rules {
+		matches := []string{}
+		for _, n := range names {
+			if r(ParseAccount(n)) {
+				matches = append(matches, n)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return matches[0], nil
+		default:
+			return "", fmt.Errorf("yubikey account %q is ambiguous, it matches %s", query, quoteAll(matches))
+		}
+	}
+	if near := nearMatches(query, names); len(near) > 0 {
+		return "", fmt.Errorf("no yubikey account matches %q, did you mean %s?", query, quoteAll(near))
+	}
+	return "", fmt.Errorf("no yubikey account matches %q", query)
+}
+
+// nearMatches returns the names sharing a name part with query or which are
+// only a few edits away from it.
+func nearMatches(query string, names []string) []string {
+	q := ParseAccount(strings.ToLower(query))
+	near := []string{}
+	for _, n := range names {
+		a := ParseAccount(strings.ToLower(n))
+		if strings.Contains(a.Name, q.Name) || strings.Contains(q.Name, a.Name) || levenshtein.Distance(a.String(), q.String()) <= 3 {
+			near = append(near, n)
+		}
+	}
+	return near
+}
+
+func quoteAll(names []string) string {
+	q := make([]string, len(names))
+	for i, n := range names {
+		q[i] = fmt.Sprintf("%q", n)
+	}
+	return strings.Join(q, ", ")
+}
@@ -0,0 +1,121 @@
+package yubiauth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAccount(t *testing.T) {
+	tests := []struct {
+		In     string
+		Issuer string
+		Name   string
+	}{
+		{"Amazon Web Services:alice@123456789012", "Amazon Web Services", "alice@123456789012"},
+		{"60/Amazon Web Services:alice@123456789012", "Amazon Web Services", "alice@123456789012"},
+		{"alice@123456789012", "", "alice@123456789012"},
+		{"Key  1", "", "Key 1"},
+		{"AWS: alice", "AWS", "alice"},
+	}
+	for _, tc := range tests {
+		a := ParseAccount(tc.In)
+		if a.Issuer != tc.Issuer || a.Name != tc.Name {
+			t.Errorf("%q: want issuer=%q name=%q, has issuer=%q name=%q", tc.In, tc.Issuer, tc.Name, a.Issuer, a.Name)
+		}
+	}
+}
+
+// outputs of the different tools and versions for the same set of accounts
+var versionOutputs = map[string]string{
+	"ykman 0.7": `Amazon Web Services:alice@123456789012 123456
+Amazon Web Services:bob@210987654321 234567
+GitHub:alice 345678
+`,
+	"ykman 3.1": `Amazon Web Services:alice@123456789012  123456
+Amazon Web Services:bob@210987654321    234567
+GitHub:alice                            345678
+Touch:alice                             [Requires Touch]
+`,
+	"ykman 4.0": `Amazon Web Services:alice@123456789012  123456
+Amazon Web Services:bob@210987654321    234567
+GitHub:alice                            345678
+Touch:alice                             [Requires Touch]
+Counter:alice                           [HOTP Account]
+`,
+	"yubioath 3.0": `Amazon Web Services:alice@123456789012   123456
+Amazon Web Services:bob@210987654321     234567
+GitHub:alice                             345678
+Touch:alice                              [Touch Credential]
+`,
+	"yubioath 0.4": `alice@123456789012   123456
+bob@210987654321     234567
+GitHub:alice         345678
+`,
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		Query string
+		Code  string
+		Err   string
+	}{
+		{Query: "alice@123456789012", Code: "123456"},
+		{Query: "ALICE@123456789012", Code: "123456"},
+		{Query: "arn:aws:iam::123456789012:mfa/alice", Code: "123456"},
+		{Query: "arn:aws-us-gov:iam::210987654321:mfa/bob", Code: "234567"},
+		{Query: "210987654321", Code: "234567"},
+		{Query: "GitHub:alice", Code: "345678"},
+		{Query: "alice@12345678901", Err: `no yubikey account matches "alice@12345678901", did you mean`},
+		{Query: "carol", Err: `no yubikey account matches "carol"`},
+	}
+	for version, out := range versionOutputs {
+		keys := parseOutput([]byte(out))
+		for _, tc := range tests {
+			name, err := keys.Match(tc.Query)
+			if tc.Err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.Err) {
+					t.Errorf("%s %q: want error %q, has %v", version, tc.Query, tc.Err, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s %q: %s", version, tc.Query, err)
+			} else if keys[name] != tc.Code {
+				t.Errorf("%s %q: want code %q, has %q (%s)", version, tc.Query, tc.Code, keys[name], name)
+			}
+		}
+	}
+}
+
+func TestMatchTouch(t *testing.T) {
+	for _, version := range []string{"ykman 3.1", "ykman 4.0", "yubioath 3.0"} {
+		keys := parseOutput([]byte(versionOutputs[version]))
+		name, err := keys.Match("touch:ALICE")
+		if err != nil {
+			t.Errorf("%s: %s", version, err)
+		} else if !keys.RequiresTouch(name) {
+			t.Errorf("%s: expected %q to require touch", version, name)
+		}
+	}
+}
+
+func TestMatchAmbiguous(t *testing.T) {
+	keys := parseOutput([]byte(`Amazon Web Services:alice@123456789012  123456
+Amazon Web Services:ci@123456789012     234567
+Other:alice                             345678
+Another:alice                           456789
+`))
+	tests := []struct {
+		Query string
+		Err   string
+	}{
+		{"123456789012", `yubikey account "123456789012" is ambiguous, it matches "Amazon Web Services:alice@123456789012", "Amazon Web Services:ci@123456789012"`},
+		{"alice", `yubikey account "alice" is ambiguous, it matches "Another:alice", "Other:alice"`},
+	}
+	for _, tc := range tests {
+		_, err := keys.Match(tc.Query)
+		if err == nil || err.Error() != tc.Err {
+			t.Errorf("%q: want error %q, has %v", tc.Query, tc.Err, err)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package yubiauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+type Command interface {
+	CombinedOutput() ([]byte, error)
+}
+
+// Commander runs cmd with args, writing stdin to its standard input, and
+// returns its output.
+type Commander func(stdin []byte, cmd string, args ...string) ([]byte, error)
+
+func defaultCommander(stdin []byte, cmd string, args ...string) ([]byte, error) {
+	c := exec.Command(cmd, args...)
+	if stdin == nil {
+		return c.CombinedOutput()
+	}
+	// the prompt for the input goes to stderr, which is only returned on
+	// errors so it does not end up in the output parsed
+	c.Stdin = bytes.NewReader(stdin)
+	stderr := &bytes.Buffer{}
+	c.Stderr = stderr
+	b, err := c.Output()
+	if err != nil {
+		return append(b, stderr.Bytes()...), err
+	}
+	return b, nil
+}
+
+// Options configure how codes are read from a YubiKey. A nil *Options is
+// valid and reads codes without password or touch support.
+type Options struct {
+	// Password returns the password of a password protected OATH applet. It
+	// is only called when ykman reports the applet to be locked.
+	Password func() (string, error)
+	// Touch is called right before waiting for the user to touch the key to
+	// calculate the code of account name.
+	Touch func(name string)
+	// Serial selects the YubiKey to use (ykman --device) when several keys
+	// are connected. When empty and several keys are connected, all of them
+	// are searched for Account and Serial is set to the one containing it.
+	Serial string
+	// Account is the name of the account codes are read for.
+	Account string
+	// Transports opens the cards to talk to directly. It defaults to all
+	// YubiKeys connected through pcscd. When it returns ErrNoTransport, ykman
+	// or yubioath are used instead.
+	Transports func() ([]Transport, error)
+	// Watch returns the watcher used to wait for keys to be connected. It
+	// defaults to watching usb devices and falls back to polling.
+	Watch func() (Watcher, error)
+	// MaxWait limits the time WaitForKeys waits for keys to be connected.
+	MaxWait time.Duration
+}
+
+func (o *Options) password() (string, error) {
+	if o == nil || o.Password == nil {
+		return "", ErrPasswordRequired
+	}
+	return o.Password()
+}
+
+func (o *Options) touch(name string) {
+	if o != nil && o.Touch != nil {
+		o.Touch(name)
+	}
+}
+
+func (o *Options) transports() ([]Transport, error) {
+	if o == nil || o.Transports == nil {
+		return pcscTransports()
+	}
+	return o.Transports()
+}
+
+func (o *Options) watch() Watcher {
+	f := newUSBWatcher
+	if o != nil && o.Watch != nil {
+		f = o.Watch
+	}
+	w, err := f()
+	if err != nil {
+		return newPollWatcher()
+	}
+	return w
+}
+
+func (o *Options) serial() string {
+	if o == nil {
+		return ""
+	}
+	return o.Serial
+}
+
+func (o *Options) account() string {
+	if o == nil {
+		return ""
+	}
+	return o.Account
+}
+
+func (o *Options) ykmanArgs(args []string) []string {
+	if o == nil || o.Serial == "" {
+		return args
+	}
+	return append([]string{"--device", o.Serial}, args...)
+}
+
+func (o *Options) withSerial(serial string) *Options {
+	c := &Options{}
+	if o != nil {
+		*c = *o
+	}
+	c.Serial = serial
+	return c
+}
+
+func WaitForKeys(ctx context.Context, opts *Options) (Keys, error) {
+	return waitForKeysWithCommander(ctx, defaultCommander, opts)
+}
+
+func ReadYubioath(opts *Options) (Keys, bool, error) {
+	return readKeys(defaultCommander, opts)
+}
+
+// ReadCode calculates the code of a single account. It is used for accounts
+// which require touch and blocks until the key was touched or the key gave up
+// waiting.
+func ReadCode(name string, opts *Options) (string, error) {
+	var code string
+	found, err := withOATHSession(opts, func(s *oathSession, _ Keys) (err error) {
+		opts.touch(name)
+		code, err = s.calculate(name, time.Now())
+		return err
+	})
+	if err == ErrNoTransport {
+		return readCodeWithCommander(defaultCommander, name, opts)
+	} else if err == nil && !found {
+		return "", fmt.Errorf("no yubikey found to calculate the code for %q", name)
+	}
+	return code, err
+}
+
+// readKeys reads the codes from the cards returned by opts.Transports and
+// falls back to ykman and yubioath.
+func readKeys(cmd Commander, opts *Options) (Keys, bool, error) {
+	var keys Keys
+	found, err := withOATHSession(opts, func(_ *oathSession, k Keys) error {
+		keys = k
+		return nil
+	})
+	if err == ErrNoTransport {
+		return readYubioathWithCommander(cmd, opts)
+	}
+	return keys, found, err
+}
+
+// withOATHSession calls f with the unlocked OATH session and all codes of the
+// card to use: the one with opts.Serial, the only one connected or the first
+// one having opts.Account. found is false when no such card is connected.
+func withOATHSession(opts *Options, f func(*oathSession, Keys) error) (found bool, err error) {
+	ts, err := opts.transports()
+	if err != nil {
+		return false, err
+	}
+	defer closeAll(ts)
+	if serial := opts.serial(); serial != "" {
+		var match Transport
+		for _, t := range ts {
+			if s, err := readSerial(t); err == nil && s == serial {
+				match = t
+				break
+			}
+		}
+		if match == nil {
+			return false, nil
+		}
+		ts = []Transport{match}
+	}
+	if len(ts) == 0 {
+		return false, nil
+	} else if len(ts) > 1 && opts.account() == "" {
+		return false, ErrMultipleKeys
+	}
+	for _, t := range ts {
+		s, err := selectOATH(t)
+		if err != nil {
+			return false, fmt.Errorf("selecting OATH application of %s: %s", t.Name(), err)
+		}
+		if err := s.unlock(opts); err != nil {
+			return false, err
+		}
+		keys, err := s.calculateAll(time.Now())
+		if err != nil {
+			return false, fmt.Errorf("calculating codes with %s: %s", t.Name(), err)
+		}
+		if len(ts) == 1 || keys.matches(opts.Account) {
+			return true, f(s, keys)
+		}
+	}
+	return false, fmt.Errorf("none of the %d connected yubikeys has an account %q", len(ts), opts.Account)
+}
+
+// waitForKeysWithCommander reads the keys once a YubiKey was connected. As
+// keys are not readable right after being connected, reading is retried with
+// readBackoff before waiting for the next key. When polling, keys are read
+// once per poll.
+func waitForKeysWithCommander(ctx context.Context, cmd Commander, opts *Options) (Keys, error) {
+	if opts != nil && opts.MaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.MaxWait)
+		defer cancel()
+	}
+	// watch before the first read to not miss keys connected in between
+	w := opts.watch()
+	defer w.Close()
+	if keys, found, err := readKeys(cmd, opts); err != nil {
+		return nil, err
+	} else if found {
+		return keys, nil
+	}
+	backoff := readBackoff
+	if _, ok := w.(*pollWatcher); ok {
+		backoff = readBackoff[:1]
+	}
+	for {
+		if err := w.Wait(ctx); err != nil {
+			return nil, err
+		}
+		for _, d := range backoff {
+			if err := sleep(ctx, d); err != nil {
+				return nil, err
+			}
+			keys, found, err := readKeys(cmd, opts)
+			if err != nil {
+				return nil, err
+			} else if found {
+				return keys, nil
+			}
+		}
+	}
+}
+
+func readYubioathWithCommander(cmd Commander, opts *Options) (Keys, bool, error) {
+	var b []byte
+	var err error
+	b, err = runYkman(cmd, opts, "oath", "code")
+	if err != nil {
+		if bytes.Contains(b, msgYkmanKeyNotFound) {
+			return nil, false, nil
+		} else if isPasswordError(err) {
+			return nil, false, err
+		} else if bytes.Contains(b, msgYkmanMultipleKeys) {
+			keys, err := scanDevicesWithCommander(cmd, opts)
+			return keys, err == nil, err
+		}
+		b, err = cmd(nil, "yubioath")
+		if err != nil {
+			if bytes.Contains(b, msgYubiKeyNotFound) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("looks like you neither have ykman nor yubioath installed:%s\n%s", b, err)
+		}
+	}
+	return parseOutput(b), true, nil
+}
+
+func readCodeWithCommander(cmd Commander, name string, opts *Options) (string, error) {
+	opts.touch(name)
+	b, err := runYkman(cmd, opts, "oath", "accounts", "code", "--single", name)
+	if err != nil && bytes.Contains(b, msgYkmanNoSuchCommand) {
+		// ykman < 4 has no accounts sub command
+		b, err = runYkman(cmd, opts, "oath", "code", "--single", name)
+	}
+	if err != nil {
+		if isPasswordError(err) {
+			return "", err
+		}
+		return "", fmt.Errorf("calculating code for %q: %s\n%s", name, err, b)
+	}
+	code := strings.TrimSpace(string(b))
+	if !isCode(code) {
+		return "", fmt.Errorf("unexpected output calculating code for %q: %q", name, code)
+	}
+	return code, nil
+}
+
+// scanDevicesWithCommander reads the codes of all connected keys and returns
+// the ones of the first key containing opts.Account.
+func scanDevicesWithCommander(cmd Commander, opts *Options) (Keys, error) {
+	if opts == nil || opts.Account == "" {
+		return nil, ErrMultipleKeys
+	}
+	serials, err := listSerialsWithCommander(cmd)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range serials {
+		dopts := opts.withSerial(s)
+		b, err := runYkman(cmd, dopts, "oath", "code")
+		if err != nil {
+			if isPasswordError(err) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("reading codes from yubikey %s: %s\n%s", s, err, b)
+		}
+		if keys := parseOutput(b); keys.matches(opts.Account) {
+			opts.Serial = s
+			return keys, nil
+		}
+	}
+	return nil, fmt.Errorf("none of the connected yubikeys (%s) has an account %q", strings.Join(serials, ", "), opts.Account)
+}
+
+func listSerialsWithCommander(cmd Commander) ([]string, error) {
+	b, err := cmd(nil, "ykman", "list", "--serials")
+	if err != nil {
+		return nil, fmt.Errorf("listing yubikeys: %s\n%s", err, b)
+	}
+	return strings.Fields(string(b)), nil
+}
+
+// Device is a connected YubiKey.
+type Device struct {
+	Serial      string
+	Description string
+	Accounts    []string
+}
+
+// Devices lists all connected keys and the names of their OATH accounts.
+func Devices(opts *Options) ([]*Device, error) {
+	devices, err := devicesNative(opts)
+	if err == ErrNoTransport {
+		return devicesWithCommander(defaultCommander, opts)
+	}
+	return devices, err
+}
+
+func devicesNative(opts *Options) ([]*Device, error) {
+	ts, err := opts.transports()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll(ts)
+	devices := []*Device{}
+	for _, t := range ts {
+		d := &Device{Description: t.Name()}
+		d.Serial, _ = readSerial(t)
+		s, err := selectOATH(t)
+		if err != nil {
+			return nil, fmt.Errorf("selecting OATH application of %s: %s", t.Name(), err)
+		}
+		if err := s.unlock(opts); err != nil {
+			return nil, err
+		}
+		if d.Accounts, err = s.list(); err != nil {
+			return nil, fmt.Errorf("listing accounts of %s: %s", t.Name(), err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+func devicesWithCommander(cmd Commander, opts *Options) ([]*Device, error) {
+	b, err := cmd(nil, "ykman", "list")
+	if err != nil {
+		return nil, fmt.Errorf("listing yubikeys: %s\n%s", err, b)
+	}
+	devices := []*Device{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		d := &Device{Description: line}
+		if i := strings.LastIndex(line, "Serial:"); i >= 0 {
+			d.Serial = strings.TrimSpace(line[i+len("Serial:"):])
+			d.Description = strings.TrimSpace(line[:i])
+		}
+		devices = append(devices, d)
+	}
+	for _, d := range devices {
+		dopts := opts.withSerial(d.Serial)
+		b, err := runYkman(cmd, dopts, "oath", "accounts", "list")
+		if err != nil && bytes.Contains(b, msgYkmanNoSuchCommand) {
+			b, err = runYkman(cmd, dopts, "oath", "list")
+		}
+		if err != nil {
+			if isPasswordError(err) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("listing accounts of yubikey %s: %s\n%s", d.Description, err, b)
+		}
+		for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			if l = strings.TrimSpace(l); l != "" {
+				d.Accounts = append(d.Accounts, l)
+			}
+		}
+	}
+	return devices, nil
+}
+
+// runYkman runs ykman with args. When ykman asks for the password of a locked
+// OATH applet, the password is requested from opts and ykman is run again.
+func runYkman(cmd Commander, opts *Options, args ...string) ([]byte, error) {
+	args = opts.ykmanArgs(args)
+	b, err := cmd(nil, "ykman", args...)
+	if err == nil || !bytes.Contains(b, msgYkmanPasswordPrompt) {
+		return b, err
+	}
+	pw, err := opts.password()
+	if err != nil {
+		return b, err
+	}
+	// ykman reads the password from stdin when it is no terminal, keeping it
+	// out of the arguments other users can see
+	b, err = cmd([]byte(pw+"\n"), "ykman", args...)
+	if err != nil && bytes.Contains(b, msgYkmanWrongPassword) {
+		return b, ErrWrongPassword
+	}
+	return b, err
+}
+
+var ErrTimeoutWaitingForKeys = fmt.Errorf("timeout waiting for keys")
+
+var (
+	ErrPasswordRequired = errors.New("the OATH application of your yubikey is password protected")
+	ErrWrongPassword    = errors.New("wrong password for the OATH application of your yubikey")
+	ErrMultipleKeys     = errors.New("multiple yubikeys connected, select one with its serial")
+)
+
+func isPasswordError(err error) bool {
+	return err == ErrPasswordRequired || err == ErrWrongPassword
+}
+
+var (
+	msgYubiKeyNotFound     = []byte("No YubiKey found!")
+	msgYkmanKeyNotFound    = []byte("No YubiKey detected!")
+	msgYkmanPasswordPrompt = []byte("password:")
+	msgYkmanWrongPassword  = []byte("Wrong password?")
+	msgYkmanNoSuchCommand  = []byte("No such command")
+	msgYkmanMultipleKeys   = []byte("Multiple YubiKeys detected")
+)
+
+func isExecutableNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "executable file not found")
+}
+
+type Keys map[string]string
+
+func (k Keys) Lookup(key string) (string, bool) {
+	v, ok := k[key]
+	return v, ok
+}
+
+func (k Keys) has(key string) bool {
+	_, ok := k[key]
+	return ok
+}
+
+func (k Keys) matches(query string) bool {
+	_, err := k.Match(query)
+	return err == nil
+}
+
+// RequiresTouch returns true when the code for key can only be calculated
+// after touching the key (see ReadCode).
+func (k Keys) RequiresTouch(key string) bool {
+	return k[key] == codeRequiresTouch
+}
+
+const codeRequiresTouch = "[Requires Touch]"
+
+// statusMarkers are printed by ykman and yubioath instead of a code. Accounts
+// with any other marker than touch (e.g. HOTP accounts) are skipped.
+var statusMarkers = map[string]string{
+	"[Requires Touch]":   codeRequiresTouch,
+	"[Touch Credential]": codeRequiresTouch,
+	"[HOTP Account]":     "",
+	"[HOTP Credential]":  "",
+}
+
+func parseOutput(in []byte) Keys {
+	m := Keys{}
+	for _, line := range strings.Split(strings.TrimSpace(string(in)), "\n") {
+		line = strings.TrimSpace(line)
+		if i := strings.LastIndex(line, "["); i > 0 && strings.HasSuffix(line, "]") {
+			if code, ok := statusMarkers[line[i:]]; ok {
+				if name := strings.TrimSpace(line[:i]); code != "" && name != "" {
+					m[name] = code
+				}
+				continue
+			}
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := strings.Join(fields[0:len(fields)-1], " ")
+		m[name] = fields[len(fields)-1]
+	}
+	return m
+}
+
+func isCode(s string) bool {
+	if len(s) < 6 || len(s) > 8 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,306 @@
+package yubiauth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOutput(t *testing.T) {
+	c := parseOutput([]byte(exampleOutput))
+	tests := []struct{ Has, Want interface{} }{
+		{len(c), 3},
+		{c["Other Type"], "345678"},
+		{c["Key 1"], "123456"},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+}
+
+type testCommanderResult struct {
+	Output string
+	Error  error
+}
+
+type testCommanderResults []*testCommanderResult
+
+func testCommander(results testCommanderResults) Commander {
+	i := 0
+	return func(stdin []byte, cmd string, args ...string) ([]byte, error) {
+		if len(results) > i {
+			r := results[i]
+			i++
+			return []byte(r.Output), r.Error
+		}
+		return nil, fmt.Errorf("no output configured for run %d", i)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	cmder := testCommander(testCommanderResults{
+		{Output: string(msgYubiKeyNotFound), Error: fmt.Errorf("no yubikey")},
+		{Output: exampleOutput},
+	})
+	ctx := context.Background()
+	w := &testWatcher{}
+	v, err := waitForKeysWithCommander(ctx, cmder, &Options{Transports: noTransports, Watch: w.watch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{w.closed, true},
+		{len(v), 3},
+		{v["Key 1"], "123456"},
+		{v["Key 1 Private"], "234567"},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+}
+
+func TestParseOutputTouch(t *testing.T) {
+	c := parseOutput([]byte(exampleOutputTouch))
+	tests := []struct{ Has, Want interface{} }{
+		{len(c), 2},
+		{c["Key 1"], "123456"},
+		{c.RequiresTouch("Key 1"), false},
+		{c.RequiresTouch("AWS:alice"), true},
+		{c.RequiresTouch("HOTP Key"), false},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+}
+
+type recordingCommander struct {
+	results testCommanderResults
+	calls   []string
+}
+
+// run records the command line followed by <stdin if there is input.
+func (r *recordingCommander) run(stdin []byte, cmd string, args ...string) ([]byte, error) {
+	call := strings.Join(append([]string{cmd}, args...), " ")
+	if stdin != nil {
+		call += " <" + strings.TrimSpace(string(stdin))
+	}
+	r.calls = append(r.calls, call)
+	return testCommander(r.results[len(r.calls)-1:])(stdin, cmd, args...)
+}
+
+func TestReadYubioathPassword(t *testing.T) {
+	cmder := &recordingCommander{results: testCommanderResults{
+		{Output: "Enter the password: \nError: Aborted!", Error: fmt.Errorf("exit status 1")},
+		{Output: exampleOutput},
+	}}
+	opts := &Options{Password: func() (string, error) { return "secret", nil }}
+	keys, found, err := readYubioathWithCommander(cmder.run, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{found, true},
+		{keys["Key 1"], "123456"},
+		{strings.Join(cmder.calls, ","), "ykman oath code,ykman oath code <secret"},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+}
+
+func TestReadYubioathPasswordErrors(t *testing.T) {
+	locked := &testCommanderResult{Output: "Enter the password: \nError: Aborted!", Error: fmt.Errorf("exit status 1")}
+	wrong := &testCommanderResult{Output: "Error: Authentication to the YubiKey failed. Wrong password?", Error: fmt.Errorf("exit status 1")}
+
+	_, _, err := readYubioathWithCommander(testCommander(testCommanderResults{locked}), nil)
+	if err != ErrPasswordRequired {
+		t.Errorf("expected ErrPasswordRequired, was %v", err)
+	}
+
+	opts := &Options{Password: func() (string, error) { return "wrong", nil }}
+	_, _, err = readYubioathWithCommander(testCommander(testCommanderResults{locked, wrong}), opts)
+	if err != ErrWrongPassword {
+		t.Errorf("expected ErrWrongPassword, was %v", err)
+	}
+}
+
+func TestReadCode(t *testing.T) {
+	cmder := &recordingCommander{results: testCommanderResults{
+		{Output: "Error: No such command 'accounts'.", Error: fmt.Errorf("exit status 2")},
+		{Output: "654321\n"},
+	}}
+	var touched string
+	opts := &Options{Touch: func(name string) { touched = name }}
+	code, err := readCodeWithCommander(cmder.run, "AWS:alice", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{code, "654321"},
+		{touched, "AWS:alice"},
+		{strings.Join(cmder.calls, ","), "ykman oath accounts code --single AWS:alice,ykman oath code --single AWS:alice"},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+}
+
+func TestReadYubioathMultipleKeys(t *testing.T) {
+	cmder := &recordingCommander{results: testCommanderResults{
+		{Output: "Error: Multiple YubiKeys detected. Use --device SERIAL to specify which one to use.", Error: fmt.Errorf("exit status 2")},
+		{Output: "1111111\n2222222\n"},
+		{Output: exampleOutput},
+		{Output: exampleOutputTouch},
+	}}
+	opts := &Options{Account: "AWS:alice"}
+	keys, found, err := readYubioathWithCommander(cmder.run, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{found, true},
+		{keys.RequiresTouch("AWS:alice"), true},
+		{opts.Serial, "2222222"},
+		{cmder.calls[3], "ykman --device 2222222 oath code"},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+
+	multiple := &testCommanderResult{Output: "Error: Multiple YubiKeys detected.", Error: fmt.Errorf("exit status 2")}
+	if _, _, err := readYubioathWithCommander(testCommander(testCommanderResults{multiple}), nil); err != ErrMultipleKeys {
+		t.Errorf("expected ErrMultipleKeys, was %v", err)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	cmder := &recordingCommander{results: testCommanderResults{
+		{Output: "YubiKey 5 NFC (5.4.3) [OTP+FIDO+CCID] Serial: 1111111\nYubiKey 5C (5.2.7) [OTP+FIDO+CCID] Serial: 2222222\n"},
+		{Output: "Key 1\nOther Type\n"},
+		{Output: "Error: No such command 'accounts'.", Error: fmt.Errorf("exit status 2")},
+		{Output: "AWS:alice\n"},
+	}}
+	devices, err := devicesWithCommander(cmder.run, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, was %d", len(devices))
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{devices[0].Serial, "1111111"},
+		{devices[0].Description, "YubiKey 5 NFC (5.4.3) [OTP+FIDO+CCID]"},
+		{strings.Join(devices[0].Accounts, ","), "Key 1,Other Type"},
+		{devices[1].Serial, "2222222"},
+		{strings.Join(devices[1].Accounts, ","), "AWS:alice"},
+		{cmder.calls[3], "ykman --device 2222222 oath list"},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+}
+
+// testWatcher returns from the first events calls of Wait as if a key was
+// connected and then blocks until the context is done.
+type testWatcher struct {
+	events int
+	waits  int
+	closed bool
+}
+
+func (w *testWatcher) watch() (Watcher, error) {
+	return w, nil
+}
+
+func (w *testWatcher) Wait(ctx context.Context) error {
+	w.waits++
+	if w.waits <= w.events {
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (w *testWatcher) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestWaitForEvent(t *testing.T) {
+	notFound := &testCommanderResult{Output: string(msgYkmanKeyNotFound), Error: fmt.Errorf("exit status 1")}
+	cmder := testCommander(testCommanderResults{notFound, {Output: exampleOutput}})
+	w := &testWatcher{events: 1}
+	v, err := waitForKeysWithCommander(context.Background(), cmder, &Options{Transports: noTransports, Watch: w.watch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.waits != 1 || v["Key 1"] != "123456" {
+		t.Errorf("expected keys to be read after waiting once, waited %d times for %v", w.waits, v)
+	}
+}
+
+func TestWaitForMaxWait(t *testing.T) {
+	notFound := &testCommanderResult{Output: string(msgYkmanKeyNotFound), Error: fmt.Errorf("exit status 1")}
+	cmder := testCommander(testCommanderResults{notFound})
+	w := &testWatcher{}
+	opts := &Options{Transports: noTransports, Watch: w.watch, MaxWait: 10 * time.Millisecond}
+	_, err := waitForKeysWithCommander(context.Background(), cmder, opts)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, was %v", err)
+	}
+	if w.waits != 1 {
+		t.Errorf("expected to wait once, waited %d times", w.waits)
+	}
+}
+
+const exampleOutputTouch = `AWS:alice                                       [Requires Touch]
+Key 1                                           123456
+HOTP Key                                        [HOTP Account]
+`
+
+const exampleOutput = `Key 1                                           123456
+Key 1 Private                                   234567
+Other Type                                      345678
+`
+
+func TestDefaultCommanderStdin(t *testing.T) {
+	script := `printf 'Enter the password: ' >&2; read pw; test "$pw" = secret && echo "Key 1  123456"`
+	b, err := defaultCommander([]byte("secret\n"), "sh", "-c", script)
+	if err != nil || string(b) != "Key 1  123456\n" {
+		t.Errorf("expected output without prompt, was %q %v", b, err)
+	}
+	b, err = defaultCommander([]byte("wrong\n"), "sh", "-c", script)
+	if err == nil || string(b) != "Enter the password: " {
+		t.Errorf("expected prompt in output of failed command, was %q %v", b, err)
+	}
+}
+
+func TestWaitForPoll(t *testing.T) {
+	notFound := &testCommanderResult{Output: string(msgYkmanKeyNotFound), Error: fmt.Errorf("exit status 1")}
+	cmder := &recordingCommander{results: testCommanderResults{notFound, notFound, notFound, {Output: exampleOutput}}}
+	w := &pollWatcher{interval: time.Millisecond, max: time.Second}
+	watch := func() (Watcher, error) { return w, nil }
+	if _, err := waitForKeysWithCommander(context.Background(), cmder.run, &Options{Transports: noTransports, Watch: watch}); err != nil {
+		t.Fatal(err)
+	}
+	// one read per poll, the interval doubled after each of the three polls
+	if len(cmder.calls) != 4 || w.interval != 8*time.Millisecond {
+		t.Errorf("expected 4 reads after 3 polls, was %d reads and interval %s", len(cmder.calls), w.interval)
+	}
+}
@@ -0,0 +1,323 @@
+package yubiauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// YKOATH protocol, see
+// https://developers.yubico.com/OATH/YKOATH_Protocol.html
+var (
+	aidOATH = []byte{0xa0, 0x00, 0x00, 0x05, 0x27, 0x21, 0x01}
+	aidOTP  = []byte{0xa0, 0x00, 0x00, 0x05, 0x27, 0x20, 0x01}
+)
+
+const (
+	insSelect        = 0xa4
+	insList          = 0xa1
+	insCalculate     = 0xa2
+	insValidate      = 0xa3
+	insCalculateAll  = 0xa4
+	insSendRemaining = 0xa5
+	insOTPSerial     = 0x01
+
+	tagName          = 0x71
+	tagNameList      = 0x72
+	tagChallenge     = 0x74
+	tagResponse      = 0x75
+	tagTruncated     = 0x76
+	tagHOTP          = 0x77
+	tagAlgorithm     = 0x7b
+	tagTouchRequired = 0x7c
+
+	algoSHA1   = 0x01
+	algoSHA256 = 0x02
+
+	swOK               = 0x9000
+	swMoreDataMask     = 0x6100
+	swAuthRequired     = 0x6982
+	swWrongData        = 0x6984
+	swConditionsNotMet = 0x6985
+	swNoSuchObject     = 0x6a82
+
+	slotDeviceSerial = 0x10
+
+	pbkdf2Iterations    = 1000
+	derivedKeyLength    = 16
+	validateChallengeSz = 8
+)
+
+type swError uint16
+
+func (e swError) Error() string {
+	return fmt.Sprintf("card returned status %04x", uint16(e))
+}
+
+// oathSession talks YKOATH to the OATH application of a card.
+type oathSession struct {
+	t Transport
+	// id is the salt of the password derived key
+	id        []byte
+	challenge []byte
+	algorithm byte
+}
+
+func selectOATH(t Transport) (*oathSession, error) {
+	rsp, err := transmit(t, 0x00, insSelect, 0x04, 0x00, aidOATH)
+	if err != nil {
+		return nil, err
+	}
+	tlvs, err := parseTLVs(rsp)
+	if err != nil {
+		return nil, err
+	}
+	s := &oathSession{t: t, algorithm: algoSHA1}
+	for _, v := range tlvs {
+		switch v.tag {
+		case tagName:
+			s.id = v.value
+		case tagChallenge:
+			s.challenge = v.value
+		case tagAlgorithm:
+			if len(v.value) == 1 {
+				s.algorithm = v.value[0]
+			}
+		}
+	}
+	return s, nil
+}
+
+// locked returns true when the OATH application is password protected.
+func (s *oathSession) locked() bool {
+	return s.challenge != nil
+}
+
+func (s *oathSession) hash() func() hash.Hash {
+	if s.algorithm == algoSHA256 {
+		return sha256.New
+	}
+	return sha1.New
+}
+
+// validate unlocks the OATH application with password.
+func (s *oathSession) validate(password string) error {
+	key := pbkdf2.Key([]byte(password), s.id, pbkdf2Iterations, derivedKeyLength, sha1.New)
+	mac := hmac.New(s.hash(), key)
+	mac.Write(s.challenge)
+	own := make([]byte, validateChallengeSz)
+	if _, err := rand.Read(own); err != nil {
+		return err
+	}
+	data := append(tlv(tagResponse, mac.Sum(nil)), tlv(tagChallenge, own)...)
+	rsp, err := transmit(s.t, 0x00, insValidate, 0x00, 0x00, data)
+	if err == swError(swWrongData) || err == swError(swAuthRequired) {
+		return ErrWrongPassword
+	} else if err != nil {
+		return err
+	}
+	tlvs, err := parseTLVs(rsp)
+	if err != nil {
+		return err
+	}
+	mac = hmac.New(s.hash(), key)
+	mac.Write(own)
+	if len(tlvs) != 1 || tlvs[0].tag != tagResponse || !hmac.Equal(tlvs[0].value, mac.Sum(nil)) {
+		return fmt.Errorf("card %s did not prove to know the password", s.t.Name())
+	}
+	s.challenge = nil
+	return nil
+}
+
+func (s *oathSession) unlock(opts *Options) error {
+	if !s.locked() {
+		return nil
+	}
+	pw, err := opts.password()
+	if err != nil {
+		return err
+	}
+	return s.validate(pw)
+}
+
+// list returns the names of all accounts.
+func (s *oathSession) list() ([]string, error) {
+	rsp, err := transmit(s.t, 0x00, insList, 0x00, 0x00, nil)
+	if err != nil {
+		return nil, err
+	}
+	tlvs, err := parseTLVs(rsp)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, v := range tlvs {
+		if v.tag == tagNameList && len(v.value) > 1 {
+			names = append(names, string(v.value[1:]))
+		}
+	}
+	return names, nil
+}
+
+// calculateAll returns the codes of all TOTP accounts at t. Accounts which
+// require touch are marked with codeRequiresTouch, HOTP accounts skipped.
+func (s *oathSession) calculateAll(t time.Time) (Keys, error) {
+	rsp, err := transmit(s.t, 0x00, insCalculateAll, 0x00, 0x01, tlv(tagChallenge, totpChallenge(t, 30*time.Second)))
+	if err != nil {
+		return nil, err
+	}
+	tlvs, err := parseTLVs(rsp)
+	if err != nil {
+		return nil, err
+	}
+	keys := Keys{}
+	for i := 0; i+1 < len(tlvs); i += 2 {
+		if tlvs[i].tag != tagName {
+			return nil, fmt.Errorf("unexpected tag %02x in calculate all response", tlvs[i].tag)
+		}
+		name, v := string(tlvs[i].value), tlvs[i+1]
+		switch v.tag {
+		case tagTruncated:
+			if p := period(name); p != 30*time.Second {
+				// calculated with the wrong challenge
+				if keys[name], err = s.calculate(name, t); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if keys[name], err = formatCode(v.value); err != nil {
+				return nil, err
+			}
+		case tagTouchRequired:
+			keys[name] = codeRequiresTouch
+		case tagHOTP:
+		default:
+			return nil, fmt.Errorf("unexpected tag %02x for %q in calculate all response", v.tag, name)
+		}
+	}
+	return keys, nil
+}
+
+// calculate returns the code of account name at t. It blocks until the card
+// was touched for accounts which require touch.
+func (s *oathSession) calculate(name string, t time.Time) (string, error) {
+	data := append(tlv(tagName, []byte(name)), tlv(tagChallenge, totpChallenge(t, period(name)))...)
+	rsp, err := transmit(s.t, 0x00, insCalculate, 0x00, 0x01, data)
+	if err == swError(swConditionsNotMet) {
+		return "", fmt.Errorf("timeout waiting for touch of %q", name)
+	} else if err == swError(swNoSuchObject) {
+		return "", fmt.Errorf("no account %q on card %s", name, s.t.Name())
+	} else if err != nil {
+		return "", err
+	}
+	tlvs, err := parseTLVs(rsp)
+	if err != nil {
+		return "", err
+	} else if len(tlvs) != 1 || tlvs[0].tag != tagTruncated {
+		return "", fmt.Errorf("unexpected calculate response for %q", name)
+	}
+	return formatCode(tlvs[0].value)
+}
+
+// readSerial reads the serial of a YubiKey from its OTP application.
+func readSerial(t Transport) (string, error) {
+	if _, err := transmit(t, 0x00, insSelect, 0x04, 0x00, aidOTP); err != nil {
+		return "", err
+	}
+	rsp, err := transmit(t, 0x00, insOTPSerial, slotDeviceSerial, 0x00, nil)
+	if err != nil {
+		return "", err
+	} else if len(rsp) != 4 {
+		return "", fmt.Errorf("unexpected serial response %x", rsp)
+	}
+	return strconv.FormatUint(uint64(binary.BigEndian.Uint32(rsp)), 10), nil
+}
+
+// period returns the time step of an account. Accounts with a step other
+// than 30 seconds are prefixed with it, e.g. "60/Issuer:name".
+func period(name string) time.Duration {
+	if m := periodPrefix.FindString(name); m != "" {
+		if p, err := strconv.Atoi(m[:len(m)-1]); err == nil && p > 0 {
+			return time.Duration(p) * time.Second
+		}
+	}
+	return 30 * time.Second
+}
+
+func totpChallenge(t time.Time, step time.Duration) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.Unix()/int64(step/time.Second)))
+	return b
+}
+
+// formatCode formats a truncated response (digits followed by 4 bytes).
+func formatCode(rsp []byte) (string, error) {
+	if len(rsp) != 5 {
+		return "", fmt.Errorf("unexpected truncated response %x", rsp)
+	}
+	digits := int(rsp[0])
+	v := binary.BigEndian.Uint32(rsp[1:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, v%mod), nil
+}
+
+// transmit sends an APDU and collects the response of all chunks. Status
+// words other than success are returned as swError.
+func transmit(t Transport, cla, ins, p1, p2 byte, data []byte) ([]byte, error) {
+	apdu := []byte{cla, ins, p1, p2}
+	if len(data) > 0 {
+		apdu = append(append(apdu, byte(len(data))), data...)
+	}
+	out := &bytes.Buffer{}
+	for {
+		rsp, err := t.Transmit(apdu)
+		if err != nil {
+			return nil, err
+		} else if len(rsp) < 2 {
+			return nil, fmt.Errorf("short response %x from card %s", rsp, t.Name())
+		}
+		out.Write(rsp[:len(rsp)-2])
+		sw := binary.BigEndian.Uint16(rsp[len(rsp)-2:])
+		switch {
+		case sw == swOK:
+			return out.Bytes(), nil
+		case sw&0xff00 == swMoreDataMask:
+			apdu = []byte{0x00, insSendRemaining, 0x00, 0x00}
+		default:
+			return nil, swError(sw)
+		}
+	}
+}
+
+type tlvValue struct {
+	tag   byte
+	value []byte
+}
+
+func tlv(tag byte, value []byte) []byte {
+	return append([]byte{tag, byte(len(value))}, value...)
+}
+
+func parseTLVs(b []byte) ([]tlvValue, error) {
+	out := []tlvValue{}
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, fmt.Errorf("truncated tlv %x", b)
+		}
+		out = append(out, tlvValue{tag: b[0], value: b[2 : 2+int(b[1])]})
+		b = b[2+int(b[1]):]
+	}
+	return out, nil
+}
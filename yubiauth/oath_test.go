@@ -0,0 +1,151 @@
+package yubiauth
+
+import (
+	"strings"
+	"testing"
+)
+
+func newSimCard() *simCard {
+	return &simCard{
+		name:      "Yubico YubiKey OTP+FIDO+CCID 00 00",
+		serial:    1234567,
+		id:        []byte{0xde, 0xad, 0xbe, 0xef, 0x01, 0x02, 0x03, 0x04},
+		chunkSize: 32,
+		accounts: []*simAccount{
+			{Name: "Amazon Web Services:alice@123456789012", Secret: rfcSecret, Digits: 6},
+			{Name: "RFC:8 digits", Secret: rfcSecret, Digits: 8},
+			{Name: "Touch:alice", Secret: rfcSecret, Digits: 6, Touch: true},
+			{Name: "Counter:alice", Secret: rfcSecret, Digits: 6, HOTP: true},
+		},
+	}
+}
+
+func TestCalculateAll(t *testing.T) {
+	c := newSimCard()
+	s, err := selectOATH(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.calculateAll(rfcTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ Has, Want interface{} }{
+		{len(keys), 3},
+		{keys["Amazon Web Services:alice@123456789012"], "287082"},
+		{keys["RFC:8 digits"], "94287082"},
+		{keys.RequiresTouch("Touch:alice"), true},
+	}
+	for i, tc := range tests {
+		if tc.Has != tc.Want {
+			t.Errorf("%d: want=%#v has=%#v", i+1, tc.Want, tc.Has)
+		}
+	}
+
+	code, err := s.calculate("Touch:alice", rfcTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" || c.touched != 1 {
+		t.Errorf("expected touched code 287082, was %q (touched %d times)", code, c.touched)
+	}
+	if _, err := s.calculate("Missing:alice", rfcTime); err == nil || !strings.Contains(err.Error(), "no account") {
+		t.Errorf("expected no account error, was %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := newSimCard()
+	c.password = "secret"
+
+	s, err := selectOATH(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.locked() {
+		t.Fatal("expected session to be locked")
+	}
+	if _, err := s.list(); err != swError(swAuthRequired) {
+		t.Errorf("expected auth required error, was %v", err)
+	}
+	if err := s.validate("wrong"); err != ErrWrongPassword {
+		t.Errorf("expected ErrWrongPassword, was %v", err)
+	}
+
+	s, _ = selectOATH(c)
+	if err := s.unlock(&Options{Password: func() (string, error) { return "secret", nil }}); err != nil {
+		t.Fatal(err)
+	}
+	names, err := s.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ex := strings.Join(names, ","), "Amazon Web Services:alice@123456789012,RFC:8 digits,Touch:alice,Counter:alice"; v != ex {
+		t.Errorf("expected names to be %q, was %q", ex, v)
+	}
+}
+
+func TestReadSerial(t *testing.T) {
+	serial, err := readSerial(newSimCard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial != "1234567" {
+		t.Errorf("expected serial 1234567, was %q", serial)
+	}
+}
+
+func TestReadKeysNative(t *testing.T) {
+	primary, backup := newSimCard(), newSimCard()
+	backup.serial = 7654321
+	backup.accounts = backup.accounts[1:2]
+
+	cmder := testCommander(nil)
+	tests := []struct {
+		Name    string
+		Opts    *Options
+		Has     string
+		Missing string
+	}{
+		{"single card", &Options{Transports: simTransports(primary)}, "Touch:alice", ""},
+		{"serial", &Options{Transports: simTransports(primary, backup), Serial: "7654321"}, "RFC:8 digits", "Touch:alice"},
+		{"account", &Options{Transports: simTransports(backup, primary), Account: "alice@123456789012"}, "Touch:alice", ""},
+	}
+	for _, tc := range tests {
+		keys, found, err := readKeys(cmder, tc.Opts)
+		if err != nil {
+			t.Errorf("%s: %s", tc.Name, err)
+			continue
+		}
+		if !found || !keys.has(tc.Has) || (tc.Missing != "" && keys.has(tc.Missing)) {
+			t.Errorf("%s: unexpected keys %v", tc.Name, keys)
+		}
+	}
+	if !primary.closed || !backup.closed {
+		t.Error("expected all cards to be closed")
+	}
+
+	_, _, err := readKeys(cmder, &Options{Transports: simTransports(primary, backup)})
+	if err != ErrMultipleKeys {
+		t.Errorf("expected ErrMultipleKeys, was %v", err)
+	}
+	_, found, err := readKeys(cmder, &Options{Transports: simTransports()})
+	if found || err != nil {
+		t.Errorf("expected no keys to be found, was found=%t err=%v", found, err)
+	}
+	_, found, err = readKeys(cmder, &Options{Transports: simTransports(primary), Serial: "7654321"})
+	if found || err != nil {
+		t.Errorf("expected key with other serial to be skipped, was found=%t err=%v", found, err)
+	}
+}
+
+func TestReadKeysFallback(t *testing.T) {
+	cmder := testCommander(testCommanderResults{{Output: exampleOutput}})
+	keys, found, err := readKeys(cmder, &Options{Transports: noTransports})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || keys["Key 1"] != "123456" {
+		t.Errorf("expected keys read using ykman, was %v", keys)
+	}
+}
@@ -0,0 +1,176 @@
+package yubiauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// simAccount is an OATH account stored on a simCard.
+type simAccount struct {
+	Name   string
+	Secret []byte
+	Digits byte
+	Touch  bool
+	HOTP   bool
+}
+
+// simCard is an in-memory YubiKey speaking YKOATH. Responses are split into
+// chunks of chunkSize bytes to exercise SEND REMAINING.
+type simCard struct {
+	name      string
+	serial    uint32
+	id        []byte
+	password  string
+	accounts  []*simAccount
+	chunkSize int
+
+	selected      []byte
+	authenticated bool
+	challenge     []byte
+	remaining     []byte
+	closed        bool
+	touched       int
+}
+
+func (c *simCard) Name() string {
+	return c.name
+}
+
+func (c *simCard) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *simCard) Transmit(apdu []byte) ([]byte, error) {
+	ins, p1 := apdu[1], apdu[2]
+	var data []byte
+	if len(apdu) > 5 {
+		data = apdu[5 : 5+int(apdu[4])]
+	}
+	if ins == insSendRemaining {
+		return c.respond(c.remaining), nil
+	}
+	if ins == insSelect && p1 == 0x04 {
+		c.selected = data
+		if bytes.Equal(data, aidOTP) {
+			return sw(swOK), nil
+		}
+		c.authenticated = c.password == ""
+		rsp := append(tlv(0x79, []byte{5, 4, 3}), tlv(tagName, c.id)...)
+		if !c.authenticated {
+			c.challenge = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+			rsp = append(rsp, tlv(tagChallenge, c.challenge)...)
+			rsp = append(rsp, tlv(tagAlgorithm, []byte{algoSHA1})...)
+		}
+		return c.respond(rsp), nil
+	}
+	if bytes.Equal(c.selected, aidOTP) {
+		if ins == insOTPSerial && p1 == slotDeviceSerial {
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, c.serial)
+			return append(b, sw(swOK)...), nil
+		}
+		return sw(0x6d00), nil
+	}
+	if ins == insValidate {
+		return c.validate(data), nil
+	}
+	if !c.authenticated {
+		return sw(swAuthRequired), nil
+	}
+	tlvs, _ := parseTLVs(data)
+	switch ins {
+	case insList:
+		rsp := []byte{}
+		for _, a := range c.accounts {
+			rsp = append(rsp, tlv(tagNameList, append([]byte{0x21}, a.Name...))...)
+		}
+		return c.respond(rsp), nil
+	case insCalculateAll:
+		rsp := []byte{}
+		for _, a := range c.accounts {
+			rsp = append(rsp, tlv(tagName, []byte(a.Name))...)
+			switch {
+			case a.HOTP:
+				rsp = append(rsp, tlv(tagHOTP, []byte{a.Digits})...)
+			case a.Touch:
+				rsp = append(rsp, tlv(tagTouchRequired, []byte{a.Digits})...)
+			default:
+				rsp = append(rsp, tlv(tagTruncated, a.truncated(tlvs[0].value))...)
+			}
+		}
+		return c.respond(rsp), nil
+	case insCalculate:
+		for _, a := range c.accounts {
+			if a.Name == string(tlvs[0].value) {
+				if a.Touch {
+					c.touched++
+				}
+				return c.respond(tlv(tagTruncated, a.truncated(tlvs[1].value))), nil
+			}
+		}
+		return sw(swNoSuchObject), nil
+	}
+	return sw(0x6d00), nil
+}
+
+func (c *simCard) validate(data []byte) []byte {
+	tlvs, _ := parseTLVs(data)
+	key := pbkdf2.Key([]byte(c.password), c.id, pbkdf2Iterations, derivedKeyLength, sha1.New)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(c.challenge)
+	if !hmac.Equal(mac.Sum(nil), tlvs[0].value) {
+		return sw(swWrongData)
+	}
+	c.authenticated = true
+	mac = hmac.New(sha1.New, key)
+	mac.Write(tlvs[1].value)
+	return c.respond(tlv(tagResponse, mac.Sum(nil)))
+}
+
+func (c *simCard) respond(rsp []byte) []byte {
+	if c.chunkSize > 0 && len(rsp) > c.chunkSize {
+		c.remaining = rsp[c.chunkSize:]
+		return append(append([]byte{}, rsp[:c.chunkSize]...), 0x61, 0x00)
+	}
+	c.remaining = nil
+	return append(append([]byte{}, rsp...), sw(swOK)...)
+}
+
+// truncated calculates the dynamically truncated HOTP value (RFC 4226).
+func (a *simAccount) truncated(challenge []byte) []byte {
+	mac := hmac.New(sha1.New, a.Secret)
+	mac.Write(challenge)
+	h := mac.Sum(nil)
+	o := h[len(h)-1] & 0x0f
+	return append([]byte{a.Digits}, h[o:o+4]...)
+}
+
+func sw(v uint16) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+func simTransports(cards ...*simCard) func() ([]Transport, error) {
+	return func() ([]Transport, error) {
+		ts := []Transport{}
+		for _, c := range cards {
+			ts = append(ts, c)
+		}
+		return ts, nil
+	}
+}
+
+func noTransports() ([]Transport, error) {
+	return nil, ErrNoTransport
+}
+
+// rfcSecret is the secret of the RFC 6238 test vectors.
+var rfcSecret = []byte("12345678901234567890")
+
+// rfcTime is a time with the RFC 6238 (SHA1, 8 digits) code 94287082.
+var rfcTime = time.Unix(59, 0)
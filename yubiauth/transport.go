@@ -0,0 +1,92 @@
+package yubiauth
+
+import (
+	"errors"
+	"strings"
+
+	pcsc "github.com/gballet/go-libpcsclite"
+)
+
+// Transport sends APDUs to a smart card, e.g. the CCID interface of a
+// YubiKey.
+type Transport interface {
+	// Name identifies the card, e.g. the name of its reader.
+	Name() string
+	// Transmit sends apdu and returns the response including the status
+	// word.
+	Transmit(apdu []byte) ([]byte, error)
+	Close() error
+}
+
+// ErrNoTransport is returned by Options.Transports when smart cards can not
+// be accessed directly. Codes are then read using ykman or yubioath.
+var ErrNoTransport = errors.New("smart cards can not be accessed directly")
+
+// pcscTransports connects to all YubiKeys available through pcscd.
+func pcscTransports() ([]Transport, error) {
+	client, err := pcsc.EstablishContext(pcsc.PCSCDSockName, pcsc.ScopeSystem)
+	if err != nil {
+		return nil, ErrNoTransport
+	}
+	defer client.ReleaseContext()
+	readers, err := client.ListReaders()
+	if err != nil {
+		return nil, err
+	}
+	out := []Transport{}
+	for _, r := range readers {
+		if !strings.Contains(strings.ToLower(r), "yubi") {
+			continue
+		}
+		t, err := openPCSC(r)
+		if err != nil {
+			closeAll(out)
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// pcscTransport is a card connected through its own pcscd context.
+type pcscTransport struct {
+	name   string
+	client *pcsc.Client
+	card   *pcsc.Card
+}
+
+func openPCSC(reader string) (*pcscTransport, error) {
+	client, err := pcsc.EstablishContext(pcsc.PCSCDSockName, pcsc.ScopeSystem)
+	if err != nil {
+		return nil, err
+	}
+	card, err := client.Connect(reader, pcsc.ShareShared, pcsc.ProtocolAny)
+	if err != nil {
+		client.ReleaseContext()
+		return nil, err
+	}
+	return &pcscTransport{name: reader, client: client, card: card}, nil
+}
+
+func (t *pcscTransport) Name() string {
+	return t.name
+}
+
+func (t *pcscTransport) Transmit(apdu []byte) ([]byte, error) {
+	rsp, _, err := t.card.Transmit(apdu)
+	return rsp, err
+}
+
+func (t *pcscTransport) Close() error {
+	err := t.card.Disconnect(pcsc.LeaveCard)
+	if rerr := t.client.ReleaseContext(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func closeAll(ts []Transport) {
+	for _, t := range ts {
+		t.Close()
+	}
+}
@@ -0,0 +1,60 @@
+package yubiauth
+
+import (
+	"context"
+	"time"
+)
+
+// Watcher waits for YubiKeys to be connected.
+type Watcher interface {
+	// Wait blocks until a YubiKey might have been connected or ctx is done.
+	Wait(ctx context.Context) error
+	Close() error
+}
+
+// readBackoff are the delays between reading codes after a key was
+// connected. pcscd and ykman need some time to pick up new keys.
+var readBackoff = []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second}
+
+// pollWatcher is used when device events are not available. It returns from
+// Wait after increasing intervals.
+type pollWatcher struct {
+	interval time.Duration
+	max      time.Duration
+}
+
+func newPollWatcher() *pollWatcher {
+	return &pollWatcher{interval: 100 * time.Millisecond, max: 2 * time.Second}
+}
+
+func (w *pollWatcher) Wait(ctx context.Context) error {
+	t := time.NewTimer(w.interval)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		if w.interval *= 2; w.interval > w.max {
+			w.interval = w.max
+		}
+		return nil
+	}
+}
+
+func (w *pollWatcher) Close() error {
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d == 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+//go:build linux
+// +build linux
+
+package yubiauth
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	usbDevDir     = "/dev/bus/usb"
+	usbSysfsGlob  = "/sys/bus/usb/devices/*/idVendor"
+	yubicoVendor  = "1050"
+	inotifyBufLen = 4096
+)
+
+// inotifyWatcher watches the device nodes of usb devices and returns from
+// Wait when a Yubico device was connected.
+type inotifyWatcher struct {
+	fd int
+	f  *os.File
+}
+
+func newUSBWatcher() (Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &inotifyWatcher{fd: fd, f: os.NewFile(uintptr(fd), "inotify")}
+	if err := w.watchBuses(); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// watchBuses watches the directory of usb buses and all bus directories for
+// new device nodes. Adding a watch twice is a no-op.
+func (w *inotifyWatcher) watchBuses() error {
+	buses, err := filepath.Glob(filepath.Join(usbDevDir, "*"))
+	if err != nil {
+		return err
+	}
+	for _, d := range append([]string{usbDevDir}, buses...) {
+		if _, err := syscall.InotifyAddWatch(w.fd, d, syscall.IN_CREATE); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *inotifyWatcher) Wait(ctx context.Context) error {
+	if err := w.f.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.f.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	buf := make([]byte, inotifyBufLen)
+	for {
+		if _, err := w.f.Read(buf); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := w.watchBuses(); err != nil {
+			return err
+		}
+		if yubikeyConnected() {
+			return nil
+		}
+	}
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.f.Close()
+}
+
+func yubikeyConnected() bool {
+	files, _ := filepath.Glob(usbSysfsGlob)
+	for _, f := range files {
+		if b, err := ioutil.ReadFile(f); err == nil && strings.TrimSpace(string(b)) == yubicoVendor {
+			return true
+		}
+	}
+	return false
+}
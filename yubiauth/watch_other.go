@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package yubiauth
+
+func newUSBWatcher() (Watcher, error) {
+	return newPollWatcher(), nil
+}